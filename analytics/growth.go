@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"errors"
+	"time"
+
+	"followers-service.xws.com/model"
+)
+
+const (
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+var ErrUnknownBucket = errors.New("bucket must be day or week")
+
+// BucketStart returns the start of the UTC bucket containing t. Weeks start
+// on Monday.
+func BucketStart(t time.Time, bucket string) time.Time {
+	year, month, day := t.UTC().Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if bucket == BucketWeek {
+		offset := (int(start.Weekday()) + 6) % 7
+		start = start.AddDate(0, 0, -offset)
+	}
+	return start
+}
+
+// Bucket sums daily growth into consecutive buckets covering [from, to).
+// Buckets without activity are included with zero counts so that charts have
+// no gaps.
+func Bucket(days []model.DailyGrowth, from time.Time, to time.Time, bucket string) ([]model.GrowthBucket, error) {
+	if bucket != BucketDay && bucket != BucketWeek {
+		return nil, ErrUnknownBucket
+	}
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if bucket == BucketWeek {
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	}
+
+	buckets := []model.GrowthBucket{}
+	index := map[time.Time]int{}
+	for start := BucketStart(from, bucket); start.Before(to); start = step(start) {
+		index[start] = len(buckets)
+		buckets = append(buckets, model.GrowthBucket{Start: start})
+	}
+
+	for _, day := range days {
+		i, ok := index[BucketStart(day.Day, bucket)]
+		if !ok {
+			continue
+		}
+		buckets[i].Gained += day.Gained
+		buckets[i].Lost += day.Lost
+		buckets[i].Net += day.Gained - day.Lost
+	}
+	return buckets, nil
+}
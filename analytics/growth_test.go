@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"followers-service.xws.com/model"
+)
+
+func date(day int, hour int) time.Time {
+	// March 2024; the 4th and 11th are Mondays
+	return time.Date(2024, 3, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestBucketStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		t      time.Time
+		bucket string
+		want   time.Time
+	}{
+		{"day at midnight", date(6, 0), BucketDay, date(6, 0)},
+		{"day mid-day", date(6, 15), BucketDay, date(6, 0)},
+		{"day from another zone", time.Date(2024, 3, 7, 1, 0, 0, 0, time.FixedZone("CET", 3600*2)), BucketDay, date(6, 0)},
+		{"week on a Monday", date(4, 9), BucketWeek, date(4, 0)},
+		{"week mid-week", date(6, 9), BucketWeek, date(4, 0)},
+		{"week on a Sunday", date(10, 23), BucketWeek, date(4, 0)},
+		{"week across a month", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), BucketWeek, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := BucketStart(test.t, test.bucket); !got.Equal(test.want) {
+				t.Fatalf("BucketStart = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	days := []model.DailyGrowth{
+		{Day: date(4, 0), Gained: 3, Lost: 1},
+		{Day: date(6, 0), Gained: 2},
+		{Day: date(11, 0), Lost: 4},
+		{Day: date(20, 0), Gained: 9}, // outside every range below
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		bucket   string
+		want     []model.GrowthBucket
+	}{
+		{
+			name: "days with gaps filled in",
+			from: date(4, 0), to: date(7, 0), bucket: BucketDay,
+			want: []model.GrowthBucket{
+				{Start: date(4, 0), Gained: 3, Lost: 1, Net: 2},
+				{Start: date(5, 0)},
+				{Start: date(6, 0), Gained: 2, Net: 2},
+			},
+		},
+		{
+			name: "partial last day is a bucket",
+			from: date(5, 0), to: date(6, 12), bucket: BucketDay,
+			want: []model.GrowthBucket{
+				{Start: date(5, 0)},
+				{Start: date(6, 0), Gained: 2, Net: 2},
+			},
+		},
+		{
+			name: "weeks start on Monday",
+			from: date(4, 0), to: date(18, 0), bucket: BucketWeek,
+			want: []model.GrowthBucket{
+				{Start: date(4, 0), Gained: 5, Lost: 1, Net: 4},
+				{Start: date(11, 0), Lost: 4, Net: -4},
+			},
+		},
+		{
+			name: "mid-week from opens at the Monday before",
+			from: date(6, 0), to: date(12, 0), bucket: BucketWeek,
+			want: []model.GrowthBucket{
+				{Start: date(4, 0), Gained: 5, Lost: 1, Net: 4},
+				{Start: date(11, 0), Lost: 4, Net: -4},
+			},
+		},
+		{
+			name: "empty range",
+			from: date(4, 0), to: date(4, 0), bucket: BucketDay,
+			want: []model.GrowthBucket{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Bucket(days, test.from, test.to, test.bucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Bucket = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBucketUnknown(t *testing.T) {
+	if _, err := Bucket(nil, date(4, 0), date(5, 0), "month"); err != ErrUnknownBucket {
+		t.Fatalf("error %v, want ErrUnknownBucket", err)
+	}
+}
@@ -0,0 +1,42 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Store aggregates the follow history of finished days.
+type Store interface {
+	RollupFollowerGrowth(ctx context.Context, until time.Time) (int, error)
+}
+
+// RollupJob keeps the daily follower growth rollups up to date. It catches
+// up on start and then checks every interval whether another day has ended.
+type RollupJob struct {
+	store    Store
+	logger   *log.Logger
+	interval time.Duration
+}
+
+func NewRollupJob(store Store, logger *log.Logger) *RollupJob {
+	return &RollupJob{store: store, logger: logger, interval: time.Hour}
+}
+
+func (j *RollupJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		days, err := j.store.RollupFollowerGrowth(ctx, time.Now().UTC())
+		if err == nil && days > 0 {
+			j.logger.Printf("Rolled up follower growth for %d day(s)", days)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
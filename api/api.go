@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 description of the REST API. It is maintained by hand
+// and has to be updated together with the routes registered in main.go.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes granted to service API keys. ScopeAdmin implies every other scope.
+const (
+	ScopeUsersWrite = "users:write"
+	ScopeGraphRead  = "graph:read"
+	ScopeAdmin      = "admin"
+)
+
+// APIKey is a credential for an internal service. Either Secret or its
+// hex encoded SHA-256 is configured; keeping only the hash in the file is
+// preferred. A key stops working after ExpiresAt, so a rotated key can be
+// added next to the old one and the old one given an expiry.
+type APIKey struct {
+	Id           string     `json:"id"`
+	Secret       string     `json:"secret,omitempty"`
+	SecretSHA256 string     `json:"secretSha256,omitempty"`
+	Scopes       []string   `json:"scopes"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+type apiKeyFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// KeyStore holds the configured API keys, indexed by the hash of their
+// secret. Keys come from the API_KEYS variable and the API_KEYS_FILE file,
+// both holding a {"keys": [...]} document. The file is reloaded when it
+// changes so keys can be rotated without a restart.
+type KeyStore struct {
+	logger  *log.Logger
+	path    string
+	envKeys []APIKey
+
+	mu      sync.RWMutex
+	keys    map[string]APIKey
+	modTime time.Time
+}
+
+func NewKeyStoreFromEnv(logger *log.Logger) (*KeyStore, error) {
+	store := &KeyStore{logger: logger, path: os.Getenv("API_KEYS_FILE")}
+	if value := os.Getenv("API_KEYS"); value != "" {
+		var file apiKeyFile
+		if err := json.Unmarshal([]byte(value), &file); err != nil {
+			return nil, fmt.Errorf("API_KEYS: %w", err)
+		}
+		store.envKeys = file.Keys
+	}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Len returns the number of configured keys, expired ones included.
+func (s *KeyStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys)
+}
+
+// Lookup returns the unexpired key whose secret is secret.
+func (s *KeyStore) Lookup(secret string) (APIKey, bool) {
+	s.mu.RLock()
+	key, ok := s.keys[hashSecret(secret)]
+	s.mu.RUnlock()
+	if !ok || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return APIKey{}, false
+	}
+	return key, true
+}
+
+// Watch reloads the key file every interval when it has been modified,
+// until ctx is cancelled. A file that fails to load keeps the previous keys.
+func (s *KeyStore) Watch(ctx context.Context, interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				s.logger.Println("Error checking API key file:", err)
+				continue
+			}
+			s.mu.RLock()
+			changed := info.ModTime() != s.modTime
+			s.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := s.reload(); err != nil {
+				s.logger.Println("Error reloading API keys:", err)
+				continue
+			}
+			s.logger.Printf("Reloaded API keys, %d configured", s.Len())
+		}
+	}
+}
+
+func (s *KeyStore) reload() error {
+	keys := append([]APIKey{}, s.envKeys...)
+	var modTime time.Time
+	if s.path != "" {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+		var file apiKeyFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("%s: %w", s.path, err)
+		}
+		keys = append(keys, file.Keys...)
+		modTime = info.ModTime()
+	}
+
+	index := make(map[string]APIKey, len(keys))
+	for _, key := range keys {
+		hash := strings.ToLower(key.SecretSHA256)
+		if key.Secret != "" {
+			hash = hashSecret(key.Secret)
+		}
+		if key.Id == "" || hash == "" {
+			return fmt.Errorf("API key %q needs an id and a secret", key.Id)
+		}
+		key.Secret = ""
+		index[hash] = key
+	}
+
+	s.mu.Lock()
+	s.keys = index
+	s.modTime = modTime
+	s.mu.Unlock()
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Caller returns the caller a request authenticated with the API key secret
+// acts as.
+func (s *KeyStore) Caller(secret string) (Caller, bool) {
+	key, ok := s.Lookup(secret)
+	if !ok {
+		return Caller{}, false
+	}
+	return Caller{KeyID: key.Id, Scopes: key.Scopes}, true
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestKeyStore loads the keys in env and file, either of which may be
+// empty, as API_KEYS and API_KEYS_FILE would.
+func newTestKeyStore(t *testing.T, env string, file string) (*KeyStore, string, error) {
+	t.Helper()
+	t.Setenv("API_KEYS", env)
+	path := ""
+	if file != "" {
+		path = filepath.Join(t.TempDir(), "keys.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("API_KEYS_FILE", path)
+	store, err := NewKeyStoreFromEnv(log.New(io.Discard, "", 0))
+	return store, path, err
+}
+
+func TestKeyStoreLookup(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	store, _, err := newTestKeyStore(t,
+		`{"keys": [{"id": "plain", "secret": "plain-secret", "scopes": ["graph:read"]}]}`,
+		`{"keys": [
+			{"id": "hashed", "secretSha256": "`+strings.ToUpper(hashSecret("hashed-secret"))+`", "scopes": ["users:write"]},
+			{"id": "expired", "secret": "expired-secret", "expiresAt": "`+past+`"},
+			{"id": "rotating", "secret": "rotating-secret", "expiresAt": "`+future+`"}
+		]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		wantID string
+	}{
+		{name: "secret from the environment", secret: "plain-secret", wantID: "plain"},
+		{name: "hashed secret from the file", secret: "hashed-secret", wantID: "hashed"},
+		{name: "expiry in the future", secret: "rotating-secret", wantID: "rotating"},
+		{name: "expired", secret: "expired-secret"},
+		{name: "unknown secret", secret: "guess"},
+		{name: "hash instead of the secret", secret: hashSecret("hashed-secret")},
+		{name: "empty", secret: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, ok := store.Lookup(test.secret)
+			if ok != (test.wantID != "") || key.Id != test.wantID {
+				t.Fatalf("Lookup = %q, %v, want %q", key.Id, ok, test.wantID)
+			}
+			if key.Secret != "" {
+				t.Fatal("Lookup returned the secret")
+			}
+		})
+	}
+}
+
+func TestKeyStoreReload(t *testing.T) {
+	store, path, err := newTestKeyStore(t, "",
+		`{"keys": [{"id": "old", "secret": "old-secret"}, {"id": "new", "secret": "new-secret"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Revoking a key is removing it from the file
+	if err := os.WriteFile(path, []byte(`{"keys": [{"id": "new", "secret": "new-secret"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Lookup("old-secret"); ok {
+		t.Fatal("revoked key still accepted")
+	}
+	if _, ok := store.Lookup("new-secret"); !ok {
+		t.Fatal("remaining key refused")
+	}
+
+	// A file that does not load keeps the keys from before
+	if err := os.WriteFile(path, []byte(`{"keys": [{"secret": "no-id"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.reload(); err == nil {
+		t.Fatal("loaded a key without an id")
+	}
+	if _, ok := store.Lookup("new-secret"); !ok {
+		t.Fatal("keys lost after a failed reload")
+	}
+}
+
+func TestNewKeyStoreFromEnvRejectsIncompleteKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+	}{
+		{name: "without id", env: `{"keys": [{"secret": "s"}]}`},
+		{name: "without secret", env: `{"keys": [{"id": "k"}]}`},
+		{name: "malformed", env: `{"keys": [`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := newTestKeyStore(t, test.env, ""); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthorizeScope(t *testing.T) {
+	store, _, err := newTestKeyStore(t,
+		`{"keys": [
+			{"id": "reader", "secret": "reader-secret", "scopes": ["graph:read"]},
+			{"id": "admin", "secret": "admin-secret", "scopes": ["admin"]}
+		]}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyCaller := func(secret string) Caller {
+		caller, ok := store.Caller(secret)
+		if !ok {
+			t.Fatalf("no caller for %q", secret)
+		}
+		return caller
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		scope   string
+		wantErr error
+	}{
+		{name: "granted scope", ctx: WithCaller(context.Background(), keyCaller("reader-secret")), scope: ScopeGraphRead},
+		{name: "scope not granted", ctx: WithCaller(context.Background(), keyCaller("reader-secret")), scope: ScopeUsersWrite, wantErr: ErrForbidden},
+		{name: "admin scope implies the others", ctx: WithCaller(context.Background(), keyCaller("admin-secret")), scope: ScopeUsersWrite},
+		{name: "admin user", ctx: WithCaller(context.Background(), Caller{UserID: 1, Role: RoleAdmin}), scope: ScopeUsersWrite},
+		{name: "user", ctx: WithCaller(context.Background(), Caller{UserID: 1}), scope: ScopeGraphRead, wantErr: ErrForbidden},
+		{name: "unauthenticated", ctx: context.Background(), scope: ScopeGraphRead, wantErr: ErrUnauthenticated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := AuthorizeScope(test.ctx, test.scope); !errors.Is(err, test.wantErr) {
+				t.Fatalf("AuthorizeScope = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
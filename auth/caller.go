@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// RoleAdmin may act on behalf of any user.
+const RoleAdmin = "admin"
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("caller is not allowed to do this")
+)
+
+// Caller is who a request is made by: a user identified by a token, or an
+// internal service identified by its API key, in which case UserID is zero.
+type Caller struct {
+	UserID int
+	Role   string
+	KeyID  string
+	Scopes []string
+}
+
+func (c Caller) IsAdmin() bool {
+	return c.Role == RoleAdmin || c.hasScope(ScopeAdmin)
+}
+
+// HasScope reports whether the caller may use endpoints guarded by scope.
+// Admins hold every scope.
+func (c Caller) HasScope(scope string) bool {
+	return c.IsAdmin() || c.hasScope(scope)
+}
+
+func (c Caller) hasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type keyCaller struct{}
+
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, keyCaller{}, caller)
+}
+
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(keyCaller{}).(Caller)
+	return caller, ok
+}
+
+// AuthorizeFor checks that the caller in ctx may act as userID: either they
+// are that user or they are an admin.
+func AuthorizeFor(ctx context.Context, userID int) error {
+	caller, ok := CallerFrom(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if (caller.UserID == 0 || caller.UserID != userID) && !caller.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeScope checks that the caller in ctx holds scope.
+func AuthorizeScope(ctx context.Context, scope string) error {
+	caller, ok := CallerFrom(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !caller.HasScope(scope) {
+		return ErrForbidden
+	}
+	return nil
+}
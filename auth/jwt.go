@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config holds the keys tokens may be signed with. HS256 tokens are checked
+// against HMACSecret and RS256 tokens against PublicKeys, looked up by the
+// kid header.
+type Config struct {
+	HMACSecret []byte
+	PublicKeys map[string]*rsa.PublicKey
+	Issuer     string
+	Audience   string
+}
+
+// ConfigFromEnv reads JWT_HMAC_SECRET, JWT_PUBLIC_KEY_FILE (a PEM encoded RSA
+// key), JWT_JWKS_FILE (a local JWKS document), JWT_ISSUER and JWT_AUDIENCE.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		PublicKeys: map[string]*rsa.PublicKey{},
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+	}
+	if secret := os.Getenv("JWT_HMAC_SECRET"); secret != "" {
+		config.HMACSecret = []byte(secret)
+	}
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return config, err
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+		config.PublicKeys[""] = key
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		keys, err := loadJWKS(path)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+		for kid, key := range keys {
+			config.PublicKeys[kid] = key
+		}
+	}
+	return config, nil
+}
+
+// Enabled reports whether any key is configured. Without keys every token is
+// rejected.
+func (c Config) Enabled() bool {
+	return len(c.HMACSecret) > 0 || len(c.PublicKeys) > 0
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS reads the RSA signing keys of a JWKS file, keyed by kid.
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus", key.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid exponent", key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+type claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks bearer tokens and turns their claims into a Caller. The
+// subject claim carries the user ID and the role claim the caller's role.
+type Verifier struct {
+	config Config
+	parser *jwt.Parser
+}
+
+func NewVerifier(config Config) *Verifier {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	return &Verifier{config: config, parser: jwt.NewParser(options...)}
+}
+
+func (v *Verifier) Verify(token string) (Caller, error) {
+	parsed := &claims{}
+	if _, err := v.parser.ParseWithClaims(token, parsed, v.key); err != nil {
+		return Caller{}, err
+	}
+	userID, err := strconv.Atoi(parsed.Subject)
+	if err != nil || userID <= 0 {
+		return Caller{}, errors.New("subject is not a user ID")
+	}
+	return Caller{UserID: userID, Role: parsed.Role}, nil
+}
+
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if len(v.config.HMACSecret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.config.HMACSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.config.PublicKeys[kid]; ok {
+			return key, nil
+		}
+		// Otherwise fall back to JWT_PUBLIC_KEY_FILE, which has no kid
+		if key, ok := v.config.PublicKeys[""]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeJWKS writes a JWKS document with the public halves of keys, by kid,
+// and points JWT_JWKS_FILE at it.
+func writeJWKS(t *testing.T, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_JWKS_FILE", path)
+}
+
+func TestVerifierVerify(t *testing.T) {
+	signingKey := newRSAKey(t)
+	otherKey := newRSAKey(t)
+	secret := []byte("hmac-secret")
+
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_PUBLIC_KEY_FILE", "")
+	t.Setenv("JWT_ISSUER", "accounts")
+	t.Setenv("JWT_AUDIENCE", "followers")
+	writeJWKS(t, map[string]*rsa.PrivateKey{"current": signingKey})
+	rsaConfig, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacConfig := Config{HMACSecret: secret, Issuer: "accounts", Audience: "followers"}
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":  "42",
+			"role": "admin",
+			"iss":  "accounts",
+			"aud":  "followers",
+			"exp":  now.Add(time.Hour).Unix(),
+		}
+	}
+	with := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := valid()
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	rs256 := func(kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	hs256 := func(secret []byte, claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	publicKeyPEM, err := x509PublicKeyPEM(&signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		token   string
+		want    Caller
+		wantErr bool
+	}{
+		{
+			name:   "RS256 signed with a JWKS key",
+			config: rsaConfig,
+			token:  rs256("current", signingKey, valid()),
+			want:   Caller{UserID: 42, Role: "admin"},
+		},
+		{
+			name:   "HS256 signed with the secret",
+			config: hmacConfig,
+			token:  hs256(secret, valid()),
+			want:   Caller{UserID: 42, Role: "admin"},
+		},
+		{
+			name:    "HS256 signed with the public key when only RS256 is configured",
+			config:  rsaConfig,
+			token:   hs256(publicKeyPEM, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "RS256 when only HS256 is configured",
+			config:  hmacConfig,
+			token:   rs256("current", signingKey, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			config:  hmacConfig,
+			token:   unsignedToken(t, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			config:  rsaConfig,
+			token:   rs256("retired", signingKey, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "missing kid",
+			config:  rsaConfig,
+			token:   rs256("", signingKey, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "known kid signed with another key",
+			config:  rsaConfig,
+			token:   rs256("current", otherKey, valid()),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "without expiry",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"exp": nil})),
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"aud": "billing"})),
+			wantErr: true,
+		},
+		{
+			name:    "without audience",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"aud": nil})),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"iss": "elsewhere"})),
+			wantErr: true,
+		},
+		{
+			name:    "subject is not a user ID",
+			config:  hmacConfig,
+			token:   hs256(secret, with(jwt.MapClaims{"sub": "service"})),
+			wantErr: true,
+		},
+		{
+			name:    "no keys configured",
+			config:  Config{},
+			token:   hs256(secret, valid()),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caller, err := NewVerifier(test.config).Verify(test.token)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Verify = %+v, want an error", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if caller.UserID != test.want.UserID || caller.Role != test.want.Role {
+				t.Fatalf("Verify = %+v, want %+v", caller, test.want)
+			}
+		})
+	}
+}
+
+func unsignedToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func x509PublicKeyPEM(key *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
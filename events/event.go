@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// SchemaVersion is bumped whenever the shape of an event payload changes in a
+// way consumers have to know about.
+const SchemaVersion = 1
+
+const (
+	Followed    = "Followed"
+	Unfollowed  = "Unfollowed"
+	UserCreated = "UserCreated"
+	UserUpdated = "UserUpdated"
+	UserDeleted = "UserDeleted"
+)
+
+// Types lists every event type the service emits.
+var Types = []string{Followed, Unfollowed, UserCreated, UserUpdated, UserDeleted}
+
+type Event struct {
+	Id         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type FollowData struct {
+	FollowerID int `json:"followerID"`
+	FollowedID int `json:"followedID"`
+}
+
+type UserData struct {
+	Id          int    `json:"Id"`
+	Username    string `json:"Username,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	AvatarUrl   string `json:"avatarUrl,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
+// Publisher delivers domain events to whoever is interested in them.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// New wraps data in an event envelope of the given type stamped with a fresh
+// ID and the current schema version.
+func New(eventType string, data interface{}) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Id:         hex.EncodeToString(id),
+		Type:       eventType,
+		Version:    SchemaVersion,
+		OccurredAt: time.Now().UTC(),
+		Data:       payload,
+	}, nil
+}
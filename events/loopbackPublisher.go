@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// LoopbackPublisher hands events straight to in-process subscribers. It is
+// used when no broker is configured and in tests that need to observe what
+// was published.
+type LoopbackPublisher struct {
+	mu          sync.RWMutex
+	subscribers []func(Event)
+}
+
+func NewLoopbackPublisher() *LoopbackPublisher {
+	return &LoopbackPublisher{}
+}
+
+// Subscribe registers fn to be called synchronously for every published event.
+func (lp *LoopbackPublisher) Subscribe(fn func(Event)) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.subscribers = append(lp.subscribers, fn)
+}
+
+func (lp *LoopbackPublisher) Publish(ctx context.Context, event Event) error {
+	lp.mu.RLock()
+	subscribers := lp.subscribers
+	lp.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+	return nil
+}
+
+func (lp *LoopbackPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"strings"
+)
+
+// PartialPublisher is a Publisher with several destinations of its own, such
+// as one per webhook, that can report which of them have an event so a retry
+// only goes to the others.
+type PartialPublisher interface {
+	Publisher
+	PublishExcept(ctx context.Context, event Event, done []string) ([]string, error)
+}
+
+// MultiPublisher fans every event out to several named publishers. The names
+// identify the publishers across restarts and replicas, so they must not
+// change between releases.
+type MultiPublisher struct {
+	names      []string
+	publishers []Publisher
+}
+
+func NewMultiPublisher() *MultiPublisher {
+	return &MultiPublisher{}
+}
+
+// Add registers publisher under name.
+func (mp *MultiPublisher) Add(name string, publisher Publisher) {
+	mp.names = append(mp.names, name)
+	mp.publishers = append(mp.publishers, publisher)
+}
+
+// Publish hands the event to every publisher and fails if any of them fails.
+func (mp *MultiPublisher) Publish(ctx context.Context, event Event) error {
+	_, err := mp.PublishExcept(ctx, event, nil)
+	return err
+}
+
+// PublishExcept hands the event to the publishers whose names are not in
+// done, which an earlier attempt already reached. It returns done together
+// with the names of the publishers that succeeded now, and the first error,
+// so that a retry only goes to the publishers that failed. The destinations a
+// PartialPublisher reached are listed as "<name>/<destination>" until it has
+// reached all of them.
+func (mp *MultiPublisher) PublishExcept(ctx context.Context, event Event, done []string) ([]string, error) {
+	published := append([]string(nil), done...)
+	var firstErr error
+	for i, publisher := range mp.publishers {
+		name := mp.names[i]
+		if contains(done, name) {
+			continue
+		}
+
+		var err error
+		if partial, ok := publisher.(PartialPublisher); ok {
+			var reached []string
+			reached, err = partial.PublishExcept(ctx, event, destinations(done, name))
+			for _, destination := range reached {
+				if !contains(published, name+"/"+destination) {
+					published = append(published, name+"/"+destination)
+				}
+			}
+		} else {
+			err = publisher.Publish(ctx, event)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		published = append(published, name)
+	}
+	return published, firstErr
+}
+
+func (mp *MultiPublisher) Close() error {
+	var firstErr error
+	for _, publisher := range mp.publishers {
+		if err := publisher.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// destinations returns the destinations of the publisher called name listed
+// in done.
+func destinations(done []string, name string) []string {
+	var reached []string
+	for _, n := range done {
+		if destination, ok := strings.CutPrefix(n, name+"/"); ok {
+			reached = append(reached, destination)
+		}
+	}
+	return reached
+}
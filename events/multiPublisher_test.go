@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakePublisher fails the events sent to the destinations in failing.
+type fakePublisher struct {
+	destinations []string
+	failing      map[string]bool
+	sent         []string
+}
+
+func (fp *fakePublisher) Publish(ctx context.Context, event Event) error {
+	_, err := fp.PublishExcept(ctx, event, nil)
+	return err
+}
+
+func (fp *fakePublisher) PublishExcept(ctx context.Context, event Event, done []string) ([]string, error) {
+	reached := append([]string(nil), done...)
+	var err error
+	for _, destination := range fp.destinations {
+		if contains(done, destination) {
+			continue
+		}
+		fp.sent = append(fp.sent, destination)
+		if fp.failing[destination] {
+			err = errors.New(destination + " failed")
+			continue
+		}
+		reached = append(reached, destination)
+	}
+	return reached, err
+}
+
+func (fp *fakePublisher) Close() error {
+	return nil
+}
+
+// countingPublisher has a single destination and counts what it was sent.
+type countingPublisher struct {
+	sent int
+}
+
+func (cp *countingPublisher) Publish(ctx context.Context, event Event) error {
+	cp.sent++
+	return nil
+}
+
+func (cp *countingPublisher) Close() error {
+	return nil
+}
+
+func TestMultiPublisherRetriesFailedDestinations(t *testing.T) {
+	broker := &countingPublisher{}
+	webhooks := &fakePublisher{destinations: []string{"a", "b", "c"}, failing: map[string]bool{"b": true}}
+	publisher := NewMultiPublisher()
+	publisher.Add("nats", broker)
+	publisher.Add("webhooks", webhooks)
+
+	done, err := publisher.PublishExcept(context.Background(), Event{Id: "1"}, nil)
+	if err == nil {
+		t.Fatal("expected the failing webhook to fail the publish")
+	}
+	if want := []string{"nats", "webhooks/a", "webhooks/c"}; !reflect.DeepEqual(done, want) {
+		t.Fatalf("done = %v, want %v", done, want)
+	}
+
+	webhooks.failing = nil
+	webhooks.sent = nil
+	done, err = publisher.PublishExcept(context.Background(), Event{Id: "1"}, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(webhooks.sent, want) {
+		t.Fatalf("retry sent to %v, want %v", webhooks.sent, want)
+	}
+	if broker.sent != 1 {
+		t.Fatalf("broker got the event %d times, want once", broker.sent)
+	}
+	if !contains(done, "webhooks") {
+		t.Fatalf("done = %v, want webhooks once all of them took the event", done)
+	}
+}
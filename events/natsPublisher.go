@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"followers-service.xws.com/tracing"
+	"github.com/nats-io/nats.go"
+)
+
+// NatsPublisher publishes every event on the subject "<prefix>.<type>", e.g.
+// followers.Followed, with the trace it belongs to in a traceparent header.
+type NatsPublisher struct {
+	conn   *nats.Conn
+	prefix string
+	logger *log.Logger
+}
+
+func NewNatsPublisher(url string, prefix string, logger *log.Logger) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("followers-service"))
+	if err != nil {
+		return nil, err
+	}
+	return &NatsPublisher{conn: conn, prefix: prefix, logger: logger}, nil
+}
+
+func (np *NatsPublisher) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(np.prefix + "." + event.Type)
+	msg.Data = payload
+	tracing.Inject(ctx, msg.Header.Set)
+	if err := np.conn.PublishMsg(msg); err != nil {
+		np.logger.Println("Error publishing event:", err)
+		return err
+	}
+	return nil
+}
+
+// Subscribe calls fn for every event published under the prefix, by this
+// instance or any other. It is how each replica learns of the events relayed
+// by the others.
+func (np *NatsPublisher) Subscribe(fn func(Event)) error {
+	_, err := np.conn.Subscribe(np.prefix+".*", func(msg *nats.Msg) {
+		event := Event{}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			np.logger.Println("Error decoding event:", err)
+			return
+		}
+		fn(event)
+	})
+	return err
+}
+
+func (np *NatsPublisher) Close() error {
+	return np.conn.Drain()
+}
@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// connectionFields return up to `first` users, so everything selected below
+// them is paid for once per user.
+var connectionFields = map[string]bool{"followers": true, "following": true, "recommendations": true}
+
+// Limits protects Neo4j from queries that fan out too far. Depth counts
+// nested fields, complexity estimates the number of resolved fields.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+type limitWalker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	visiting  map[string]bool
+}
+
+// Check rejects the operation in document if it exceeds the limits.
+func (l Limits) Check(document *ast.Document, operationName string, variables map[string]interface{}) error {
+	walker := limitWalker{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		visiting:  map[string]bool{},
+	}
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			walker.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operations = append(operations, definition)
+			}
+		}
+	}
+
+	for _, operation := range operations {
+		depth, complexity, err := walker.measure(operation.SelectionSet)
+		if err != nil {
+			return err
+		}
+		if depth > l.MaxDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+		}
+		if complexity > l.MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+func (w *limitWalker) measure(selectionSet *ast.SelectionSet) (int, int, error) {
+	if selectionSet == nil {
+		return 0, 0, nil
+	}
+
+	maxDepth, complexity := 0, 0
+	for _, selection := range selectionSet.Selections {
+		var depth, cost int
+		var err error
+		switch selection := selection.(type) {
+		case *ast.Field:
+			depth, cost, err = w.measure(selection.SelectionSet)
+			if err != nil {
+				return 0, 0, err
+			}
+			depth++
+			if connectionFields[selection.Name.Value] {
+				cost *= w.pageSize(selection)
+			}
+			cost++
+		case *ast.InlineFragment:
+			depth, cost, err = w.measure(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := w.fragments[name]
+			if !ok {
+				return 0, 0, fmt.Errorf("unknown fragment %q", name)
+			}
+			if w.visiting[name] {
+				return 0, 0, fmt.Errorf("fragment %q spreads itself", name)
+			}
+			w.visiting[name] = true
+			depth, cost, err = w.measure(fragment.SelectionSet)
+			w.visiting[name] = false
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		complexity += cost
+	}
+	return maxDepth, complexity, nil
+}
+
+// pageSize is the `first` argument of a connection field, resolving
+// variables, or the default page size when it is not given. A value the
+// resolver would reject is costed as the largest page, so it cannot lower
+// the complexity of the rest of the query.
+func (w *limitWalker) pageSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			first, err := strconv.Atoi(value.Value)
+			if err != nil {
+				return maxPageSize
+			}
+			return clampPageSize(first)
+		case *ast.Variable:
+			switch first := w.variables[value.Name.Value].(type) {
+			case float64:
+				if first < 1 || first > maxPageSize {
+					return maxPageSize
+				}
+				return int(first)
+			case int:
+				return clampPageSize(first)
+			case nil:
+				return defaultPageSize
+			default:
+				return maxPageSize
+			}
+		default:
+			return maxPageSize
+		}
+	}
+	return defaultPageSize
+}
+
+func clampPageSize(first int) int {
+	if first < 1 || first > maxPageSize {
+		return maxPageSize
+	}
+	return first
+}
@@ -0,0 +1,191 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+func parse(t *testing.T, query string) *ast.Document {
+	t.Helper()
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		t.Fatalf("parsing %q: %v", query, err)
+	}
+	return document
+}
+
+// TestLimitsComplexity checks the cost of each query by running it against
+// limits just at and just below that cost.
+func TestLimitsComplexity(t *testing.T) {
+	const followers = `edges { node { id } }` // costs 3 per user
+
+	tests := []struct {
+		name       string
+		query      string
+		variables  map[string]interface{}
+		complexity int
+	}{
+		{
+			name:       "default page size",
+			query:      `{ user(id: 1) { followers { ` + followers + ` } } }`,
+			complexity: 3*defaultPageSize + 2,
+		},
+		{
+			name:       "explicit first",
+			query:      `{ user(id: 1) { followers(first: 5) { ` + followers + ` } } }`,
+			complexity: 3*5 + 2,
+		},
+		{
+			name:       "negative first costs the largest page",
+			query:      `{ user(id: 1) { followers(first: -100000) { ` + followers + ` } } }`,
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "zero first costs the largest page",
+			query:      `{ user(id: 1) { followers(first: 0) { ` + followers + ` } } }`,
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "oversized first costs the largest page",
+			query:      `{ user(id: 1) { followers(first: 100000) { ` + followers + ` } } }`,
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "first overflowing an int costs the largest page",
+			query:      `{ user(id: 1) { followers(first: 99999999999999999999) { ` + followers + ` } } }`,
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "variable first",
+			query:      `query ($n: Int) { user(id: 1) { followers(first: $n) { ` + followers + ` } } }`,
+			variables:  map[string]interface{}{"n": float64(20)},
+			complexity: 3*20 + 2,
+		},
+		{
+			name:       "negative variable first costs the largest page",
+			query:      `query ($n: Int) { user(id: 1) { followers(first: $n) { ` + followers + ` } } }`,
+			variables:  map[string]interface{}{"n": float64(-5)},
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "oversized variable first costs the largest page",
+			query:      `query ($n: Int) { user(id: 1) { followers(first: $n) { ` + followers + ` } } }`,
+			variables:  map[string]interface{}{"n": float64(1e9)},
+			complexity: 3*maxPageSize + 2,
+		},
+		{
+			name:       "missing variable uses the default page size",
+			query:      `query ($n: Int) { user(id: 1) { followers(first: $n) { ` + followers + ` } } }`,
+			complexity: 3*defaultPageSize + 2,
+		},
+		{
+			name:       "nested connections multiply",
+			query:      `{ user(id: 1) { followers(first: 10) { edges { node { following(first: 5) { ` + followers + ` } } } } } }`,
+			complexity: (((3*5+1)+2)*10 + 1) + 1,
+		},
+		{
+			name: "fragments are costed where they are spread",
+			query: `{ user(id: 1) { ...F } }
+				fragment F on User { followers(first: 2) { edges { node { id username } } } }`,
+			complexity: 4*2 + 2,
+		},
+		{
+			name:       "inline fragments are costed",
+			query:      `{ user(id: 1) { ... on User { followers(first: 2) { ` + followers + ` } } } }`,
+			complexity: 3*2 + 2,
+		},
+		{
+			name: "aliases add up",
+			query: `{
+				a: user(id: 1) { followers(first: 2) { ` + followers + ` } }
+				b: user(id: 2) { followers(first: 2) { ` + followers + ` } }
+			}`,
+			complexity: 2 * (3*2 + 2),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := parse(t, test.query)
+			if err := (Limits{MaxDepth: 100, MaxComplexity: test.complexity}).Check(document, "", test.variables); err != nil {
+				t.Fatalf("rejected at its own complexity: %v", err)
+			}
+			err := (Limits{MaxDepth: 100, MaxComplexity: test.complexity - 1}).Check(document, "", test.variables)
+			if err == nil || !strings.Contains(err.Error(), "complexity") {
+				t.Fatalf("accepted below its complexity, error %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxDepth: 8, MaxComplexity: 5000}
+
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		wantErr   string
+	}{
+		{
+			name:  "small query passes",
+			query: `{ user(id: 1) { id followers(first: 10) { edges { node { id } } } } }`,
+		},
+		{
+			name: "negative first cannot pay for another alias",
+			query: `{
+				a: user(id: 1) { followers(first: -100000) { edges { node { id } } } }
+				b: user(id: 2) { followers(first: 100) { edges { node { followers(first: 100) { edges { node { followerCount } } } } } } }
+			}`,
+			wantErr: "complexity",
+		},
+		{
+			name:    "too deep",
+			query:   `{ user(id: 1) { followers { edges { node { followers { edges { node { followers { edges { node { id } } } } } } } } } } }`,
+			wantErr: "depth",
+		},
+		{
+			name:    "unknown fragment",
+			query:   `{ user(id: 1) { ...Missing } }`,
+			wantErr: "unknown fragment",
+		},
+		{
+			name: "fragment spreading itself",
+			query: `{ user(id: 1) { ...F } }
+				fragment F on User { followers { edges { node { ...F } } } }`,
+			wantErr: "spreads itself",
+		},
+		{
+			name: "only the named operation is checked",
+			query: `query Small { user(id: 1) { id } }
+				query Big { user(id: 1) { followers(first: 100) { edges { node { followers(first: 100) { edges { node { id } } } } } } } }`,
+			operation: "Small",
+		},
+		{
+			name: "the named operation is checked",
+			query: `query Small { user(id: 1) { id } }
+				query Big { user(id: 1) { followers(first: 100) { edges { node { followers(first: 100) { edges { node { id } } } } } } } }`,
+			operation: "Big",
+			wantErr:   "complexity",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := limits.Check(parse(t, test.query), test.operation, nil)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("error %v, want one mentioning %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/model"
+	"followers-service.xws.com/ratelimit"
+	"followers-service.xws.com/repo"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// NewSchema builds the social graph schema on top of the repository. Follow
+// mutations count against the daily follow cap of limiter; failures to
+// update the cap are logged to logger.
+func NewSchema(r *repo.FollowRepo, limiter *ratelimit.Limiter, logger *log.Logger) (graphql.Schema, error) {
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "User",
+		Fields: graphql.Fields{},
+	})
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(userType)},
+		},
+	})
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+	connectionArgs := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{Type: graphql.Int},
+		"after": &graphql.ArgumentConfig{Type: graphql.String},
+		"q":     &graphql.ArgumentConfig{Type: graphql.String},
+	}
+
+	userType.AddFieldConfig("id", &graphql.Field{Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.User).Id, nil }})
+	userType.AddFieldConfig("username", &graphql.Field{Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.User).Username, nil }})
+	userType.AddFieldConfig("displayName", &graphql.Field{Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.User).DisplayName, nil }})
+	userType.AddFieldConfig("avatarUrl", &graphql.Field{Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.User).AvatarUrl, nil }})
+	userType.AddFieldConfig("role", &graphql.Field{Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.User).Role, nil }})
+	userType.AddFieldConfig("followerCount", &graphql.Field{Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			followers, _, err := r.GetFollowCounts(p.Context, p.Source.(model.User).Id)
+			return followers, err
+		}})
+	userType.AddFieldConfig("followingCount", &graphql.Field{Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			_, following, err := r.GetFollowCounts(p.Context, p.Source.(model.User).Id)
+			return following, err
+		}})
+	userType.AddFieldConfig("mutual", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Boolean),
+		Description: "Whether this user and the given user follow each other.",
+		Args: graphql.FieldConfigArgument{
+			"with": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID := p.Source.(model.User).Id
+			otherID := p.Args["with"].(int)
+			follows, err := r.CheckFollow(p.Context, userID, otherID)
+			if err != nil || !follows {
+				return false, err
+			}
+			return r.CheckFollow(p.Context, otherID, userID)
+		}})
+	userType.AddFieldConfig("followers", &graphql.Field{Type: graphql.NewNonNull(connectionType), Args: connectionArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolveConnection(p, r.GetUserFollowerUsers)
+		}})
+	userType.AddFieldConfig("following", &graphql.Field{Type: graphql.NewNonNull(connectionType), Args: connectionArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolveConnection(p, r.GetUserFollowingUsers)
+		}})
+	userType.AddFieldConfig("recommendations", &graphql.Field{Type: graphql.NewNonNull(connectionType), Args: connectionArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolveConnection(p, func(ctx context.Context, userID int, options repo.ListOptions) ([]model.User, error) {
+				ids, err := r.GetFollowRecommendations(ctx, userID)
+				if err != nil {
+					return nil, err
+				}
+				if options.Skip >= len(ids) {
+					return []model.User{}, nil
+				}
+				ids = ids[options.Skip:]
+				if len(ids) > options.Limit {
+					ids = ids[:options.Limit]
+				}
+				return r.GetUsersByIds(ctx, ids)
+			})
+		}})
+
+	followType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Follow",
+		Fields: graphql.Fields{
+			"followerId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.Follow).FollowerID, nil }},
+			"followedId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(model.Follow).FollowedID, nil }},
+		},
+	})
+	followArgs := graphql.FieldConfigArgument{
+		"followerId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		"followedId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user, err := r.GetUser(p.Context, p.Args["id"].(int))
+					if errors.Is(err, repo.ErrUserNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return *user, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"follow": &graphql.Field{
+				Type: graphql.NewNonNull(followType),
+				Args: followArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := auth.AuthorizeFor(p.Context, p.Args["followerId"].(int)); err != nil {
+						return nil, err
+					}
+					_, err := limiter.AllowFollow(p.Context, p.Args["followerId"].(int))
+					if errors.Is(err, ratelimit.ErrDailyFollowCap) {
+						return nil, err
+					}
+					counted := err == nil
+					if err != nil {
+						logger.Println("Error checking follow cap:", err)
+					}
+					follow, followErr := r.FollowUser(p.Context, p.Args["followerId"].(int), p.Args["followedId"].(int))
+					if followErr != nil && counted {
+						if err := limiter.ReleaseFollow(p.Context, p.Args["followerId"].(int)); err != nil {
+							logger.Println("Error releasing follow cap:", err)
+						}
+					}
+					return follow, followErr
+				},
+			},
+			"unfollow": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: followArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					follow := model.Follow{FollowerID: p.Args["followerId"].(int), FollowedID: p.Args["followedId"].(int)}
+					if err := auth.AuthorizeFor(p.Context, follow.FollowerID); err != nil {
+						return false, err
+					}
+					if err := r.UnfollowUser(p.Context, follow); err != nil {
+						return false, err
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// resolveConnection pages through fetch using opaque offset cursors. One
+// extra user is requested to find out whether there is a next page.
+func resolveConnection(p graphql.ResolveParams, fetch func(context.Context, int, repo.ListOptions) ([]model.User, error)) (interface{}, error) {
+	first, offset, err := pageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	query, _ := p.Args["q"].(string)
+
+	users, err := fetch(p.Context, p.Source.(model.User).Id, repo.ListOptions{Query: query, Skip: offset, Limit: first + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	hasNextPage := len(users) > first
+	if hasNextPage {
+		users = users[:first]
+	}
+	edges := make([]map[string]interface{}, 0, len(users))
+	for i, user := range users {
+		edges = append(edges, map[string]interface{}{"cursor": encodeCursor(offset + i + 1), "node": user})
+	}
+	pageInfo := map[string]interface{}{"hasNextPage": hasNextPage}
+	if len(edges) > 0 {
+		pageInfo["endCursor"] = edges[len(edges)-1]["cursor"]
+	}
+	return map[string]interface{}{"edges": edges, "pageInfo": pageInfo}, nil
+}
+
+func pageArgs(args map[string]interface{}) (int, int, error) {
+	first := defaultPageSize
+	if value, ok := args["first"].(int); ok {
+		if value <= 0 || value > maxPageSize {
+			return 0, 0, errors.New("first must be between 1 and 100")
+		}
+		first = value
+	}
+	offset := 0
+	if after, ok := args["after"].(string); ok && after != "" {
+		decoded, err := decodeCursor(after)
+		if err != nil {
+			return 0, 0, err
+		}
+		offset = decoded
+	}
+	return first, offset, nil
+}
+
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	value, found := strings.CutPrefix(string(decoded), "offset:")
+	if !found {
+		return 0, errInvalidCursor
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errInvalidCursor
+	}
+	return offset, nil
+}
@@ -0,0 +1,297 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/model"
+	pb "followers-service.xws.com/proto/followers"
+	"followers-service.xws.com/ratelimit"
+	"followers-service.xws.com/repo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// FollowersServer serves the FollowersService on top of the same FollowRepo
+// as the REST handlers.
+type FollowersServer struct {
+	pb.UnimplementedFollowersServiceServer
+	logger  *log.Logger
+	repo    *repo.FollowRepo
+	limiter *ratelimit.Limiter
+}
+
+func NewFollowersServer(l *log.Logger, r *repo.FollowRepo, rl *ratelimit.Limiter) *FollowersServer {
+	return &FollowersServer{logger: l, repo: r, limiter: rl}
+}
+
+// NewGRPCServer registers the followers service together with the standard
+// health and reflection services. Callers are identified by the x-api-key or
+// authorization metadata and charged to the same rate limits as for the REST
+// API.
+func NewGRPCServer(followers *FollowersServer, verifier *auth.Verifier, keys *auth.KeyStore) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		authenticate(followers.logger, verifier, keys),
+		rateLimit(followers.logger, followers.limiter),
+	))
+	pb.RegisterFollowersServiceServer(server, followers)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.FollowersService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+func (s *FollowersServer) AddUser(ctx context.Context, request *pb.AddUserRequest) (*pb.AddUserResponse, error) {
+	if request.GetUser() == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	if err := auth.AuthorizeScope(ctx, auth.ScopeUsersWrite); err != nil {
+		return nil, s.toStatus(err)
+	}
+	user := &model.User{
+		Id:          int(request.User.GetId()),
+		Username:    request.User.GetUsername(),
+		DisplayName: request.User.GetDisplayName(),
+		AvatarUrl:   request.User.GetAvatarUrl(),
+		Role:        request.User.GetRole(),
+	}
+	if err := user.Validate(); err != nil {
+		return nil, invalidArgument(err)
+	}
+	if err := s.repo.AddUser(ctx, user); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.AddUserResponse{}, nil
+}
+
+// authenticate puts the caller of a request carrying an API key or a bearer
+// token in its context. Requests without either continue anonymously.
+func authenticate(logger *log.Logger, verifier *auth.Verifier, keys *auth.KeyStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if values := metadata.ValueFromIncomingContext(ctx, "x-api-key"); len(values) > 0 {
+			caller, ok := keys.Caller(values[0])
+			if !ok {
+				return nil, status.Error(codes.Unauthenticated, "invalid API key")
+			}
+			logger.Printf("API key %s: %s", caller.KeyID, info.FullMethod)
+			return handler(auth.WithCaller(ctx, caller), request)
+		}
+
+		values := metadata.ValueFromIncomingContext(ctx, "authorization")
+		if len(values) == 0 {
+			return handler(ctx, request)
+		}
+		token, found := strings.CutPrefix(values[0], "Bearer ")
+		if !found {
+			return nil, status.Error(codes.Unauthenticated, "expected a bearer token")
+		}
+		caller, err := verifier.Verify(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return handler(auth.WithCaller(ctx, caller), request)
+	}
+}
+
+// writeMethods are charged to the write budget, everything else to the read
+// budget.
+var writeMethods = map[string]bool{
+	pb.FollowersService_AddUser_FullMethodName:  true,
+	pb.FollowersService_Follow_FullMethodName:   true,
+	pb.FollowersService_Unfollow_FullMethodName: true,
+}
+
+// rateLimit charges every call to the budget of the peer address and, when
+// authenticated, of the caller, like the REST middleware. If the store fails
+// calls are let through.
+func rateLimit(logger *log.Logger, limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		allowed, retryAfter, err := limiter.AllowRequest(ctx, ratelimit.Keys(ctx, peerIP(ctx)), writeMethods[info.FullMethod])
+		if err != nil {
+			logger.Println("Error checking rate limit:", err)
+		} else if !allowed {
+			return nil, rateLimited(ctx, retryAfter, "too many requests")
+		}
+		return handler(ctx, request)
+	}
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return ip
+}
+
+// invalidArgument reports validation errors as InvalidArgument with a
+// BadRequest detail listing the rejected fields.
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	var fieldErrors model.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return st.Err()
+	}
+	badRequest := &errdetails.BadRequest{}
+	for _, fieldError := range fieldErrors {
+		badRequest.FieldViolations = append(badRequest.FieldViolations,
+			&errdetails.BadRequest_FieldViolation{Field: fieldError.Field, Description: fieldError.Message})
+	}
+	if detailed, detailErr := st.WithDetails(badRequest); detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// rateLimited is a ResourceExhausted status. The seconds to wait go in the
+// retry-after trailer, as the REST API sends Retry-After.
+func rateLimited(ctx context.Context, retryAfter time.Duration, message string) error {
+	grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+	return status.Error(codes.ResourceExhausted, message)
+}
+
+func (s *FollowersServer) Follow(ctx context.Context, request *pb.FollowRequest) (*pb.FollowResponse, error) {
+	followerID := int(request.GetFollowerId())
+	if err := auth.AuthorizeFor(ctx, followerID); err != nil {
+		return nil, s.toStatus(err)
+	}
+	retryAfter, err := s.limiter.AllowFollow(ctx, followerID)
+	if errors.Is(err, ratelimit.ErrDailyFollowCap) {
+		return nil, rateLimited(ctx, retryAfter, err.Error())
+	}
+	counted := err == nil
+	if err != nil {
+		s.logger.Println("Error checking follow cap:", err)
+	}
+
+	follow, err := s.repo.FollowUser(ctx, followerID, int(request.GetFollowedId()))
+	if err != nil {
+		if counted {
+			if err := s.limiter.ReleaseFollow(ctx, followerID); err != nil {
+				s.logger.Println("Error releasing follow cap:", err)
+			}
+		}
+		return nil, s.toStatus(err)
+	}
+	return &pb.FollowResponse{Follow: toProtoFollow(follow)}, nil
+}
+
+func (s *FollowersServer) Unfollow(ctx context.Context, request *pb.UnfollowRequest) (*pb.UnfollowResponse, error) {
+	follow := model.Follow{FollowerID: int(request.GetFollowerId()), FollowedID: int(request.GetFollowedId())}
+	if err := auth.AuthorizeFor(ctx, follow.FollowerID); err != nil {
+		return nil, s.toStatus(err)
+	}
+	if err := s.repo.UnfollowUser(ctx, follow); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.UnfollowResponse{}, nil
+}
+
+func (s *FollowersServer) CheckFollow(ctx context.Context, request *pb.CheckFollowRequest) (*pb.CheckFollowResponse, error) {
+	following, err := s.repo.CheckFollow(ctx, int(request.GetFollowerId()), int(request.GetFollowedId()))
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.CheckFollowResponse{Following: following}, nil
+}
+
+func (s *FollowersServer) ListFollowing(ctx context.Context, request *pb.ListRequest) (*pb.ListFollowsResponse, error) {
+	options, err := listOptions(request)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := s.repo.GetUserFollowing(ctx, int(request.GetUserId()), options)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.ListFollowsResponse{Follows: toProtoFollows(follows)}, nil
+}
+
+func (s *FollowersServer) ListFollowers(ctx context.Context, request *pb.ListRequest) (*pb.ListFollowsResponse, error) {
+	options, err := listOptions(request)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := s.repo.GetUserFollowers(ctx, int(request.GetUserId()), options)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.ListFollowsResponse{Follows: toProtoFollows(follows)}, nil
+}
+
+func (s *FollowersServer) ListFollowingIds(ctx context.Context, request *pb.ListFollowingIdsRequest) (*pb.ListFollowingIdsResponse, error) {
+	ids, err := s.repo.GetUserFollowingIds(ctx, int(request.GetUserId()))
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.ListFollowingIdsResponse{FollowedIds: ids}, nil
+}
+
+func (s *FollowersServer) Recommend(ctx context.Context, request *pb.RecommendRequest) (*pb.RecommendResponse, error) {
+	ids, err := s.repo.GetFollowRecommendations(ctx, int(request.GetUserId()))
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.RecommendResponse{UserIds: ids}, nil
+}
+
+// toStatus maps repository errors onto gRPC status codes.
+func (s *FollowersServer) toStatus(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repo.ErrAlreadyFollowing):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repo.ErrSelfFollow):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repo.ErrFollowingLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		s.logger.Println("gRPC request failed:", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func listOptions(request *pb.ListRequest) (repo.ListOptions, error) {
+	if request.GetOffset() < 0 || request.GetLimit() < 0 {
+		return repo.ListOptions{}, status.Error(codes.InvalidArgument, "offset and limit must not be negative")
+	}
+	return repo.ListOptions{Query: request.GetQuery(), Skip: int(request.GetOffset()), Limit: int(request.GetLimit())}, nil
+}
+
+func toProtoFollow(follow model.Follow) *pb.Follow {
+	return &pb.Follow{FollowerId: int64(follow.FollowerID), FollowedId: int64(follow.FollowedID)}
+}
+
+func toProtoFollows(follows []model.Follow) []*pb.Follow {
+	protoFollows := make([]*pb.Follow, 0, len(follows))
+	for _, follow := range follows {
+		protoFollows = append(protoFollows, toProtoFollow(follow))
+	}
+	return protoFollows
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"followers-service.xws.com/model"
+	"followers-service.xws.com/repo"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxAudienceAuthors = 100
+	audienceFlushEvery = 1000
+	audienceWriteSlack = 10 * time.Second
+)
+
+// AudienceHandler streams follower IDs to the feed service for fan-out.
+type AudienceHandler struct {
+	logger *log.Logger
+	repo   *repo.FollowRepo
+}
+
+func NewAudienceHandler(l *log.Logger, r *repo.FollowRepo) *AudienceHandler {
+	return &AudienceHandler{l, r}
+}
+
+// GetAudience streams the follower IDs of one author as NDJSON, one
+// {"followerID": n} object per line.
+func (a *AudienceHandler) GetAudience(rw http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	a.streamAudience(rw, r, []int{authorID}, false)
+}
+
+// GetBatchAudience streams the followers of several authors as NDJSON, each
+// line carrying both the author and the follower ID.
+func (a *AudienceHandler) GetBatchAudience(rw http.ResponseWriter, r *http.Request) {
+	request := r.Context().Value(KeyProduct{}).(*model.AudienceRequest)
+	if len(request.AuthorIDs) == 0 || len(request.AuthorIDs) > maxAudienceAuthors {
+		writeBadRequest(rw, "Validation failed", model.FieldError{Field: "authorIDs", Message: "must contain between 1 and 100 IDs"})
+		return
+	}
+	for _, authorID := range request.AuthorIDs {
+		if authorID <= 0 {
+			writeBadRequest(rw, "Validation failed", model.FieldError{Field: "authorIDs", Message: "must only contain positive integers"})
+			return
+		}
+	}
+	a.streamAudience(rw, r, request.AuthorIDs, true)
+}
+
+func (a *AudienceHandler) streamAudience(rw http.ResponseWriter, r *http.Request, authorIDs []int, withAuthor bool) {
+	controller := http.NewResponseController(rw)
+	encoder := json.NewEncoder(rw)
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+
+	written := 0
+	err := a.repo.StreamAudience(r.Context(), authorIDs, func(authorID int, followerID int) error {
+		if written%audienceFlushEvery == 0 {
+			// Large audiences take longer than the server write timeout
+			controller.SetWriteDeadline(time.Now().Add(audienceWriteSlack))
+			if written > 0 {
+				if err := controller.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		member := model.AudienceMember{FollowerID: followerID}
+		if withAuthor {
+			member.AuthorID = authorID
+		}
+		written++
+		return encoder.Encode(member)
+	})
+	if err != nil {
+		a.logger.Println("Error streaming audience:", err)
+		if written == 0 {
+			writeError(rw, err)
+		}
+		// Once lines have been sent the status can no longer change; the
+		// client sees a truncated body
+		return
+	}
+	controller.Flush()
+}
+
+func (a *AudienceHandler) MiddlewareAudienceDeserialization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		request := &model.AudienceRequest{}
+		err := request.FromJSON(h.Body)
+		if err != nil {
+			writeDecodeError(rw, err)
+			return
+		}
+		ctx := context.WithValue(h.Context(), KeyProduct{}, request)
+		h = h.WithContext(ctx)
+		next.ServeHTTP(rw, h)
+	})
+}
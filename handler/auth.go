@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"followers-service.xws.com/auth"
+	"github.com/gorilla/mux"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// MiddlewareAuthenticate identifies the caller from an X-API-Key header for
+// internal services or from a bearer token for users, and puts it in the
+// request context. Requests without credentials pass through anonymously;
+// handlers that need a caller reject them.
+func MiddlewareAuthenticate(logger *log.Logger, verifier *auth.Verifier, keys *auth.KeyStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+			if secret := h.Header.Get(apiKeyHeader); secret != "" {
+				caller, ok := keys.Caller(secret)
+				if !ok {
+					writeUnauthenticated(rw, "Invalid API key")
+					return
+				}
+				logger.Printf("API key %s: %s %s", caller.KeyID, h.Method, h.URL.Path)
+				next.ServeHTTP(rw, h.WithContext(auth.WithCaller(h.Context(), caller)))
+				return
+			}
+
+			header := h.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(rw, h)
+				return
+			}
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				writeUnauthenticated(rw, "Expected a bearer token")
+				return
+			}
+			caller, err := verifier.Verify(token)
+			if err != nil {
+				logger.Println("Rejected token:", err)
+				writeUnauthenticated(rw, "Invalid token")
+				return
+			}
+			next.ServeHTTP(rw, h.WithContext(auth.WithCaller(h.Context(), caller)))
+		})
+	}
+}
+
+// MiddlewareRequireScope only lets callers holding scope through.
+func MiddlewareRequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+			if err := auth.AuthorizeScope(h.Context(), scope); err != nil {
+				writeError(rw, err)
+				return
+			}
+			next.ServeHTTP(rw, h)
+		})
+	}
+}
+
+func writeUnauthenticated(rw http.ResponseWriter, detail string) {
+	rw.Header().Set("WWW-Authenticate", `Bearer realm="followers-service"`)
+	writeProblem(rw, http.StatusUnauthorized, CodeUnauthenticated, detail)
+}
@@ -3,34 +3,66 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"followers-service.xws.com/analytics"
+	"followers-service.xws.com/auth"
 	"followers-service.xws.com/model"
+	"followers-service.xws.com/ratelimit"
 	"followers-service.xws.com/repo"
 	"github.com/gorilla/mux"
 )
 
 type FollowsHandler struct {
-	logger *log.Logger
-	repo   *repo.FollowRepo
+	logger  *log.Logger
+	repo    *repo.FollowRepo
+	limiter *ratelimit.Limiter
 }
 
 type KeyProduct struct{}
 
-func NewFollowsHandler(l *log.Logger, r *repo.FollowRepo) *FollowsHandler {
-	return &FollowsHandler{l, r}
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	defaultGrowthDays = 30
+	maxGrowthRange    = 5 * 366 * 24 * time.Hour
+)
+
+func NewFollowsHandler(l *log.Logger, r *repo.FollowRepo, rl *ratelimit.Limiter) *FollowsHandler {
+	return &FollowsHandler{l, r, rl}
 }
 
 func (f *FollowsHandler) FollowUser(rw http.ResponseWriter, r *http.Request) {
 	follows := r.Context().Value(KeyProduct{}).(*model.Follow)
 	f.logger.Println("Follows: ", follows)
+	if err := auth.AuthorizeFor(r.Context(), follows.FollowerID); err != nil {
+		writeError(rw, err)
+		return
+	}
+	retryAfter, err := f.limiter.AllowFollow(r.Context(), follows.FollowerID)
+	if errors.Is(err, ratelimit.ErrDailyFollowCap) {
+		writeRateLimited(rw, retryAfter, err.Error())
+		return
+	}
+	counted := err == nil
+	if err != nil {
+		f.logger.Println("Error checking follow cap:", err)
+	}
 
-	newFollow, err := f.repo.FollowUser(follows.FollowerID, follows.FollowedID)
+	newFollow, err := f.repo.FollowUser(r.Context(), follows.FollowerID, follows.FollowedID)
 	if err != nil {
 		f.logger.Println("Error creating follow:", err)
-		rw.WriteHeader(http.StatusBadRequest)
+		if counted {
+			if err := f.limiter.ReleaseFollow(r.Context(), follows.FollowerID); err != nil {
+				f.logger.Println("Error releasing follow cap:", err)
+			}
+		}
+		writeError(rw, err)
 		return
 	}
 
@@ -38,7 +70,7 @@ func (f *FollowsHandler) FollowUser(rw http.ResponseWriter, r *http.Request) {
 	followJSON, err := json.Marshal(newFollow)
 	if err != nil {
 		f.logger.Println("Error marshaling follow:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 
@@ -50,7 +82,7 @@ func (f *FollowsHandler) FollowUser(rw http.ResponseWriter, r *http.Request) {
 	_, err = rw.Write(followJSON)
 	if err != nil {
 		f.logger.Println("Error writing follow response:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 }
@@ -58,14 +90,26 @@ func (f *FollowsHandler) FollowUser(rw http.ResponseWriter, r *http.Request) {
 func (f *FollowsHandler) UnfollowUser(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	followedId, err := strconv.Atoi(vars["followedId"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid followed ID")
+		return
+	}
 	followingId, err := strconv.Atoi(vars["followingId"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid follower ID")
+		return
+	}
 
 	follows := &model.Follow{FollowedID: followedId, FollowerID: followingId}
+	if err := auth.AuthorizeFor(r.Context(), follows.FollowerID); err != nil {
+		writeError(rw, err)
+		return
+	}
 
-	err = f.repo.UnfollowUser(*follows)
+	err = f.repo.UnfollowUser(r.Context(), *follows)
 	if err != nil {
 		f.logger.Println("Error unfollowing user:", err)
-		rw.WriteHeader(http.StatusBadRequest)
+		writeError(rw, err)
 		return
 	}
 	rw.WriteHeader(http.StatusOK)
@@ -75,59 +119,171 @@ func (f *FollowsHandler) CheckFollow(rw http.ResponseWriter, r *http.Request) {
 	follows := r.Context().Value(KeyProduct{}).(*model.Follow)
 	f.logger.Println("Follows: ", follows)
 
-	isFollowed, err := f.repo.CheckFollow(follows.FollowerID, follows.FollowedID)
+	isFollowed, err := f.repo.CheckFollow(r.Context(), follows.FollowerID, follows.FollowedID)
 	if err != nil {
 		f.logger.Println("Error checking follow:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
-	if isFollowed {
-		rw.WriteHeader(http.StatusOK)
-		rw.Write([]byte("User is following"))
-	} else {
-		rw.WriteHeader(http.StatusNotFound)
-		rw.Write([]byte("User is not following"))
+	if !isFollowed {
+		writeProblem(rw, http.StatusNotFound, CodeNotFollowing, "User is not following")
+		return
 	}
+	json.NewEncoder(rw).Encode(struct {
+		Following bool `json:"following"`
+	}{true})
 }
 
 func (u *FollowsHandler) AddUser(rw http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(KeyProduct{}).(*model.User)
 	u.logger.Println("User: ", user)
 
-	err := u.repo.AddUser(user)
+	err := u.repo.AddUser(r.Context(), user)
 	if err != nil {
 		u.logger.Println("Error creating user:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 
 	rw.WriteHeader(http.StatusCreated)
 }
 
+// UpdateUser replaces the profile of a user. Callers without the users:write
+// scope may only replace their own profile, and keep their role.
+func (u *FollowsHandler) UpdateUser(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+
+	user := r.Context().Value(KeyProduct{}).(*model.User)
+	if user.Id != 0 && user.Id != userID {
+		writeBadRequest(rw, "Validation failed", model.FieldError{Field: "Id", Message: "does not match the user ID in the path"})
+		return
+	}
+	user.Id = userID
+	if err := user.Validate(); err != nil {
+		writeValidationError(rw, err)
+		return
+	}
+	patch := model.UserPatch{Username: &user.Username, DisplayName: &user.DisplayName, AvatarUrl: &user.AvatarUrl}
+	if user.Role != "" || auth.AuthorizeScope(r.Context(), auth.ScopeUsersWrite) == nil {
+		patch.Role = &user.Role
+	}
+	u.updateUser(rw, r, userID, patch)
+}
+
+// PatchUser changes the profile fields present in the body.
+func (u *FollowsHandler) PatchUser(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	u.updateUser(rw, r, userID, *r.Context().Value(KeyProduct{}).(*model.UserPatch))
+}
+
+func (u *FollowsHandler) updateUser(rw http.ResponseWriter, r *http.Request, userID int, patch model.UserPatch) {
+	// Users may edit their own profile but not their role; sending the role
+	// they already have is not a change
+	if err := auth.AuthorizeScope(r.Context(), auth.ScopeUsersWrite); err != nil {
+		if err := auth.AuthorizeFor(r.Context(), userID); err != nil {
+			writeError(rw, err)
+			return
+		}
+		if patch.Role != nil {
+			stored, err := u.repo.GetUser(r.Context(), userID)
+			if err != nil {
+				writeError(rw, err)
+				return
+			}
+			if *patch.Role != stored.Role {
+				writeError(rw, auth.ErrForbidden)
+				return
+			}
+			patch.Role = nil
+		}
+	}
+
+	updatedUser, err := u.repo.UpdateUser(r.Context(), userID, patch)
+	if err != nil {
+		u.logger.Println("Error updating user:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := updatedUser.ToJSON(rw); err != nil {
+		u.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (u *FollowsHandler) DeleteUser(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+
+	if err := auth.AuthorizeScope(r.Context(), auth.ScopeUsersWrite); err != nil {
+		if err := auth.AuthorizeFor(r.Context(), userID); err != nil {
+			writeError(rw, err)
+			return
+		}
+	}
+
+	removedEdges, err := u.repo.DeleteUser(r.Context(), userID)
+	if err != nil {
+		u.logger.Println("Error deleting user:", err)
+		writeError(rw, err)
+		return
+	}
+	u.logger.Printf("Deleted user %d and %d follow relationships", userID, removedEdges)
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 func (u *FollowsHandler) GetUserFollowing(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currentUserID, err := strconv.Atoi(vars["user_id"])
 	if err != nil {
 		u.logger.Printf("Expected integer, got: %d", currentUserID)
-		http.Error(rw, "Unable to convert limit to integer", http.StatusBadRequest)
+		writeBadRequest(rw, "Unable to convert limit to integer")
+		return
+	}
+
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
 		return
 	}
 
 	u.logger.Println("Current user ID:", currentUserID)
-	followingIDs, err := u.repo.GetUserFollowing(currentUserID)
+	if r.URL.Query().Get("expand") == "user" {
+		u.writeUsers(rw, r, u.repo.GetUserFollowingUsers, currentUserID, options)
+		return
+	}
+
+	followingIDs, err := u.repo.GetUserFollowing(r.Context(), currentUserID, options)
 	if err != nil {
 		u.logger.Println("Error fetching user following:", err)
+		writeError(rw, err)
 		return
 	}
 
 	if followingIDs == nil {
-		return
+		followingIDs = []model.Follow{}
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(rw).Encode(followingIDs); err != nil {
 		u.logger.Println("Error encoding JSON response:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 }
@@ -137,25 +293,26 @@ func (u *FollowsHandler) GetUserFollowingIds(rw http.ResponseWriter, r *http.Req
 	currentUserID, err := strconv.Atoi(vars["user_id"])
 	if err != nil {
 		u.logger.Printf("Expected integer, got: %d", currentUserID)
-		http.Error(rw, "Unable to convert limit to integer", http.StatusBadRequest)
+		writeBadRequest(rw, "Unable to convert limit to integer")
 		return
 	}
 
 	u.logger.Println("Current user ID:", currentUserID)
-	followingIDs, err := u.repo.GetUserFollowingIds(currentUserID)
+	followingIDs, err := u.repo.GetUserFollowingIds(r.Context(), currentUserID)
 	if err != nil {
 		u.logger.Println("Error fetching user following:", err)
+		writeError(rw, err)
 		return
 	}
 
 	if followingIDs == nil {
-		return
+		followingIDs = []int64{}
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(rw).Encode(followingIDs); err != nil {
 		u.logger.Println("Error encoding JSON response:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 }
@@ -165,25 +322,233 @@ func (u *FollowsHandler) GetUserFollowers(rw http.ResponseWriter, r *http.Reques
 	currentUserID, err := strconv.Atoi(vars["user_id"])
 	if err != nil {
 		u.logger.Printf("Expected integer, got: %d", currentUserID)
-		http.Error(rw, "Unable to convert limit to integer", http.StatusBadRequest)
+		writeBadRequest(rw, "Unable to convert limit to integer")
+		return
+	}
+
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
 		return
 	}
 
 	u.logger.Println("Current user ID:", currentUserID)
-	followingIDs, err := u.repo.GetUserFollowers(currentUserID)
+	if r.URL.Query().Get("expand") == "user" {
+		u.writeUsers(rw, r, u.repo.GetUserFollowerUsers, currentUserID, options)
+		return
+	}
+
+	followingIDs, err := u.repo.GetUserFollowers(r.Context(), currentUserID, options)
 	if err != nil {
 		u.logger.Println("Error fetching user followers:", err)
+		writeError(rw, err)
 		return
 	}
 
 	if followingIDs == nil {
-		return
+		followingIDs = []model.Follow{}
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(rw).Encode(followingIDs); err != nil {
 		u.logger.Println("Error encoding JSON response:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (u *FollowsHandler) GetCommonFollowing(rw http.ResponseWriter, r *http.Request) {
+	u.writeUserSet(rw, r, "other_id", u.repo.GetCommonFollowing)
+}
+
+func (u *FollowsHandler) GetFollowersNotFollowing(rw http.ResponseWriter, r *http.Request) {
+	u.writeUserSet(rw, r, "other_id", u.repo.GetFollowersNotFollowing)
+}
+
+func (u *FollowsHandler) GetFollowersYouKnow(rw http.ResponseWriter, r *http.Request) {
+	u.writeUserSet(rw, r, "viewer_id", u.repo.GetFollowersYouKnow)
+}
+
+// writeUserSet serves the endpoints that combine the networks of user_id and
+// a second user taken from the otherVar path variable.
+func (u *FollowsHandler) writeUserSet(rw http.ResponseWriter, r *http.Request, otherVar string,
+	fetch func(context.Context, int, int, repo.ListOptions) ([]model.User, error)) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	otherID, err := strconv.Atoi(vars[otherVar])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+
+	u.writeUsers(rw, r, func(ctx context.Context, userID int, options repo.ListOptions) ([]model.User, error) {
+		return fetch(ctx, userID, otherID, options)
+	}, userID, options)
+}
+
+func (u *FollowsHandler) SearchUsers(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("q")
+	if prefix == "" {
+		writeBadRequest(rw, "Query parameter q is required")
+		return
+	}
+
+	// People the caller follows are ranked first; key callers get no ranking
+	callerID := 0
+	if caller, ok := auth.CallerFrom(r.Context()); ok {
+		callerID = caller.UserID
+	}
+
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			writeBadRequest(rw, "Invalid limit")
+			return
+		}
+		if l < maxSearchLimit {
+			limit = l
+		} else {
+			limit = maxSearchLimit
+		}
+	}
+
+	users, err := u.repo.SearchUsers(r.Context(), prefix, callerID, limit)
+	if err != nil {
+		u.logger.Println("Error searching users:", err)
+		writeError(rw, err)
+		return
+	}
+	if users == nil {
+		users = []model.User{}
+	}
+
+	if err := json.NewEncoder(rw).Encode(users); err != nil {
+		u.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (u *FollowsHandler) GetUserHistory(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	// The history shows who a user followed and when, so only they and
+	// admins may read it
+	if err := auth.AuthorizeFor(r.Context(), userID); err != nil {
+		writeError(rw, err)
+		return
+	}
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+
+	history, err := u.repo.GetUserHistory(r.Context(), userID, from, to, options)
+	if err != nil {
+		u.logger.Println("Error fetching history:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(history); err != nil {
+		u.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (u *FollowsHandler) GetFollowerGrowth(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	// Growth is counted from the history, which only the user and admins
+	// may read
+	if err := auth.AuthorizeFor(r.Context(), userID); err != nil {
+		writeError(rw, err)
+		return
+	}
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+	if r.URL.Query().Get("from") == "" {
+		from = to.AddDate(0, 0, -defaultGrowthDays)
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = analytics.BucketDay
+	}
+	if bucket != analytics.BucketDay && bucket != analytics.BucketWeek {
+		writeBadRequest(rw, analytics.ErrUnknownBucket.Error())
+		return
+	}
+	// The first bucket covers a whole day or week like the others
+	from = analytics.BucketStart(from, bucket)
+	if to.Sub(from) > maxGrowthRange {
+		writeBadRequest(rw, "Time range is too long")
+		return
+	}
+
+	days, err := u.repo.GetFollowerGrowth(r.Context(), userID, from, to)
+	if err != nil {
+		u.logger.Println("Error fetching follower growth:", err)
+		writeError(rw, err)
+		return
+	}
+	buckets, err := analytics.Bucket(days, from, to, bucket)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(buckets); err != nil {
+		u.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+// writeUsers encodes the user profiles returned by fetch, used when a list
+// endpoint is asked to expand IDs into embedded user summaries.
+func (u *FollowsHandler) writeUsers(rw http.ResponseWriter, r *http.Request, fetch func(context.Context, int, repo.ListOptions) ([]model.User, error), userID int, options repo.ListOptions) {
+	users, err := fetch(r.Context(), userID, options)
+	if err != nil {
+		u.logger.Println("Error fetching users:", err)
+		writeError(rw, err)
+		return
+	}
+	if users == nil {
+		users = []model.User{}
+	}
+
+	if err := json.NewEncoder(rw).Encode(users); err != nil {
+		u.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
 		return
 	}
 }
@@ -193,13 +558,13 @@ func (u *FollowsHandler) GetFollowingRecommendation(rw http.ResponseWriter, r *h
 	personID := vars["user_id"]
 	personIDInt, err := strconv.Atoi(personID)
 	if err != nil {
-		http.Error(rw, "Invalid user ID", http.StatusBadRequest)
+		writeBadRequest(rw, "Invalid user ID")
 		return
 	}
-	reccommendationIds, err := u.repo.GetFollowRecommendations(personIDInt)
+	reccommendationIds, err := u.repo.GetFollowRecommendations(r.Context(), personIDInt)
 	if err != nil {
 		u.logger.Println("Error fetching recommendations:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 
@@ -207,12 +572,62 @@ func (u *FollowsHandler) GetFollowingRecommendation(rw http.ResponseWriter, r *h
 	jsonRecommendations, err := json.Marshal(reccommendationIds)
 	if err != nil {
 		u.logger.Println("Error marshalling recommendation IDs:", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		writeError(rw, err)
 		return
 	}
 	rw.Write(jsonRecommendations)
 }
 
+// parseListOptions reads the q, offset and limit query parameters shared by
+// the follower and following list endpoints.
+func parseListOptions(r *http.Request) (repo.ListOptions, error) {
+	query := r.URL.Query()
+	options := repo.ListOptions{Query: query.Get("q")}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return options, errors.New("Invalid offset")
+		}
+		options.Skip = offset
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return options, errors.New("Invalid limit")
+		}
+		options.Limit = limit
+	}
+	return options, nil
+}
+
+// parseTimeRange reads the RFC 3339 from and to query parameters. A missing
+// from means the beginning of time and a missing to means now.
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	from := time.Unix(0, 0).UTC()
+	to := time.Now().UTC()
+
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, errors.New("Invalid from, expected RFC 3339 time")
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, errors.New("Invalid to, expected RFC 3339 time")
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
 func (m *FollowsHandler) MiddlewareContentTypeSet(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
 		m.logger.Println("Method [", h.Method, "] - Hit path :", h.URL.Path)
@@ -228,8 +643,11 @@ func (f *FollowsHandler) MiddlewareFollowDeserialization(next http.Handler) http
 		person := &model.Follow{}
 		err := person.FromJSON(h.Body)
 		if err != nil {
-			http.Error(rw, "Unable to decode json", http.StatusBadRequest)
-			f.logger.Fatal(err)
+			writeDecodeError(rw, err)
+			return
+		}
+		if err := person.Validate(); err != nil {
+			writeValidationError(rw, err)
 			return
 		}
 		ctx := context.WithValue(h.Context(), KeyProduct{}, person)
@@ -243,12 +661,35 @@ func (u *FollowsHandler) MiddlewareUserDeserialization(next http.Handler) http.H
 		person := &model.User{}
 		err := person.FromJSON(h.Body)
 		if err != nil {
-			http.Error(rw, "Unable to decode json", http.StatusBadRequest)
-			u.logger.Fatal(err)
+			writeDecodeError(rw, err)
 			return
 		}
+		// PUT checks the username itself, as the ID comes from the path
+		if h.Method == http.MethodPost {
+			if err := person.Validate(); err != nil {
+				writeValidationError(rw, err)
+				return
+			}
+		}
 		ctx := context.WithValue(h.Context(), KeyProduct{}, person)
 		h = h.WithContext(ctx)
 		next.ServeHTTP(rw, h)
 	})
 }
+
+func (u *FollowsHandler) MiddlewareUserPatchDeserialization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		patch := &model.UserPatch{}
+		if err := patch.FromJSON(h.Body); err != nil {
+			writeDecodeError(rw, err)
+			return
+		}
+		if err := patch.Validate(); err != nil {
+			writeValidationError(rw, err)
+			return
+		}
+		ctx := context.WithValue(h.Context(), KeyProduct{}, patch)
+		h = h.WithContext(ctx)
+		next.ServeHTTP(rw, h)
+	})
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"followers-service.xws.com/graph"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+type GraphQLHandler struct {
+	logger *log.Logger
+	schema graphql.Schema
+	limits graph.Limits
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func NewGraphQLHandler(l *log.Logger, s graphql.Schema, limits graph.Limits) *GraphQLHandler {
+	return &GraphQLHandler{l, s, limits}
+}
+
+// ServeGraphQL executes a query sent either as a JSON POST body or in the
+// query string of a GET request. Queries over the depth or complexity limits
+// are rejected before anything is resolved.
+func (g *GraphQLHandler) ServeGraphQL(rw http.ResponseWriter, r *http.Request) {
+	request := graphQLRequest{}
+	if r.Method == http.MethodGet {
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				writeDecodeError(rw, err)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeDecodeError(rw, err)
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(request.Query)})})
+	if err != nil {
+		g.writeResult(rw, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if err := g.limits.Check(document, request.OperationName, request.Variables); err != nil {
+		g.writeResult(rw, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         g.schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        r.Context(),
+	})
+	g.writeResult(rw, http.StatusOK, result)
+}
+
+func (g *GraphQLHandler) writeResult(rw http.ResponseWriter, status int, result *graphql.Result) {
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(result); err != nil {
+		g.logger.Println("Error encoding JSON response:", err)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"followers-service.xws.com/metrics"
+	"github.com/gorilla/mux"
+)
+
+// statusRecorder remembers the status code written through it. Unwrap keeps
+// http.ResponseController working for the streaming handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// MiddlewareMetrics counts requests and records their latency by route
+// template, method and status code.
+func MiddlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		route := routeTemplate(h)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: rw}
+		next.ServeHTTP(recorder, h)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		metrics.ObserveRequest(route, h.Method, strconv.Itoa(recorder.status), time.Since(start))
+	})
+}
+
+// routeTemplate returns the path template of the route serving h, so
+// requests for different users are grouped together.
+func routeTemplate(h *http.Request) string {
+	if current := mux.CurrentRoute(h); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unknown"
+}
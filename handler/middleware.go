@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+
+	// maxBodyBytes bounds every request body; the largest legitimate bodies
+	// are audience requests with 100 author IDs.
+	maxBodyBytes = 1 << 20
+)
+
+type keyRequestID struct{}
+
+// RequestID returns the ID MiddlewareRequestID assigned to the request, or an
+// empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(keyRequestID{}).(string)
+	return id
+}
+
+// MiddlewareRequestID keeps the caller's X-Request-ID, or generates one, and
+// echoes it on the response so log lines can be matched to requests.
+func MiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		id := h.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		rw.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(h.Context(), keyRequestID{}, id)
+		next.ServeHTTP(rw, h.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// MiddlewareRecover turns a panic in a handler into a 500 problem instead of
+// dropping the connection, logging the stack under the request ID.
+func MiddlewareRecover(logger *log.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				// Let net/http abort the response as it would without us
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				id := RequestID(h.Context())
+				logger.Printf("Panic serving %s %s (request %s): %v\n%s", h.Method, h.URL.Path, id, recovered, debug.Stack())
+				writeProblem(rw, http.StatusInternalServerError, CodeInternalError, "Internal error, request ID "+id)
+			}()
+			next.ServeHTTP(rw, h)
+		})
+	}
+}
+
+// MiddlewareLimitBody caps request bodies at maxBodyBytes. Decoding a larger
+// body fails with an *http.MaxBytesError, reported as a 413.
+func MiddlewareLimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		h.Body = http.MaxBytesReader(rw, h.Body, maxBodyBytes)
+		next.ServeHTTP(rw, h)
+	})
+}
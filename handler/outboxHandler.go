@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"followers-service.xws.com/outbox"
+)
+
+type OutboxHandler struct {
+	logger *log.Logger
+	relay  *outbox.Relay
+}
+
+func NewOutboxHandler(l *log.Logger, r *outbox.Relay) *OutboxHandler {
+	return &OutboxHandler{l, r}
+}
+
+func (o *OutboxHandler) GetOutboxStats(rw http.ResponseWriter, r *http.Request) {
+	stats, err := o.relay.Stats(r.Context())
+	if err != nil {
+		o.logger.Println("Error fetching outbox stats:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(stats); err != nil {
+		o.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
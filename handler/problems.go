@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/model"
+	"followers-service.xws.com/repo"
+)
+
+// Stable error codes returned in the code member of every problem. Clients
+// should branch on these rather than on the human readable title or detail.
+const (
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeMalformedJSON    = "MALFORMED_JSON"
+	CodeBodyTooLarge     = "BODY_TOO_LARGE"
+	CodeUserNotFound     = "USER_NOT_FOUND"
+	CodeNotFollowing     = "NOT_FOLLOWING"
+	CodeWebhookNotFound  = "WEBHOOK_NOT_FOUND"
+	CodeNotFlagged       = "NOT_FLAGGED"
+	CodeAlreadyFollowing = "ALREADY_FOLLOWING"
+	CodeSelfFollow       = "SELF_FOLLOW"
+	CodeFollowingLimit   = "FOLLOWING_LIMIT_REACHED"
+	CodeUnauthenticated  = "UNAUTHENTICATED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeRateLimited      = "RATE_LIMITED"
+	CodeInternalError    = "INTERNAL_ERROR"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body, extended with a stable code
+// and, for validation failures, the offending fields.
+type Problem struct {
+	Type   string                 `json:"type"`
+	Title  string                 `json:"title"`
+	Status int                    `json:"status"`
+	Detail string                 `json:"detail,omitempty"`
+	Code   string                 `json:"code"`
+	Fields model.ValidationErrors `json:"fields,omitempty"`
+}
+
+// errorProblems maps the sentinel errors of the repository and of auth to the
+// status and code they are reported with.
+var errorProblems = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{repo.ErrUserNotFound, http.StatusNotFound, CodeUserNotFound},
+	{repo.ErrWebhookNotFound, http.StatusNotFound, CodeWebhookNotFound},
+	{repo.ErrNotFlagged, http.StatusNotFound, CodeNotFlagged},
+	{repo.ErrAlreadyFollowing, http.StatusConflict, CodeAlreadyFollowing},
+	{repo.ErrSelfFollow, http.StatusUnprocessableEntity, CodeSelfFollow},
+	{repo.ErrFollowingLimit, http.StatusUnprocessableEntity, CodeFollowingLimit},
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated},
+	{auth.ErrForbidden, http.StatusForbidden, CodeForbidden},
+}
+
+func writeProblem(rw http.ResponseWriter, status int, code string, detail string, fields ...model.FieldError) {
+	problem := Problem{
+		Type:   "urn:followers-service:problem:" + strings.ToLower(strings.ReplaceAll(code, "_", "-")),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Fields: fields,
+	}
+	rw.Header().Set("Content-Type", problemContentType)
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(problem)
+}
+
+// writeError is the single place errors returned by the repository are
+// turned into responses. Unknown errors become a 500 without leaking their
+// message, callers are expected to have logged them.
+func writeError(rw http.ResponseWriter, err error) {
+	var fields model.ValidationErrors
+	if errors.As(err, &fields) {
+		writeProblem(rw, http.StatusBadRequest, CodeValidationFailed, "Validation failed", fields...)
+		return
+	}
+	for _, mapping := range errorProblems {
+		if errors.Is(err, mapping.err) {
+			writeProblem(rw, mapping.status, mapping.code, err.Error())
+			return
+		}
+	}
+	writeProblem(rw, http.StatusInternalServerError, CodeInternalError, "")
+}
+
+func writeBadRequest(rw http.ResponseWriter, message string, fields ...model.FieldError) {
+	writeProblem(rw, http.StatusBadRequest, CodeValidationFailed, message, fields...)
+}
+
+// writeDecodeError reports a request body that could not be decoded, either
+// because it is not valid JSON for the expected type or because it exceeds
+// the body size limit.
+func writeDecodeError(rw http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(rw, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, err.Error())
+		return
+	}
+	writeProblem(rw, http.StatusBadRequest, CodeMalformedJSON, "Unable to decode json: "+err.Error())
+}
+
+// writeValidationError reports err as a 400, listing the offending fields
+// when err is a model.ValidationErrors.
+func writeValidationError(rw http.ResponseWriter, err error) {
+	var fields model.ValidationErrors
+	if errors.As(err, &fields) {
+		writeBadRequest(rw, "Validation failed", fields...)
+		return
+	}
+	writeBadRequest(rw, err.Error())
+}
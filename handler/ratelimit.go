@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"followers-service.xws.com/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// MiddlewareRateLimit charges every request to the budget of the client
+// address and, when authenticated, of the caller. Reads and writes have
+// separate budgets. If the store fails requests are let through.
+func MiddlewareRateLimit(logger *log.Logger, limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+			write := h.Method != http.MethodGet && h.Method != http.MethodHead && h.Method != http.MethodOptions
+			allowed, retryAfter, err := limiter.AllowRequest(h.Context(), rateLimitKeys(h), write)
+			if err != nil {
+				logger.Println("Error checking rate limit:", err)
+			} else if !allowed {
+				writeRateLimited(rw, retryAfter, "Too many requests")
+				return
+			}
+			next.ServeHTTP(rw, h)
+		})
+	}
+}
+
+func rateLimitKeys(h *http.Request) []string {
+	ip, _, err := net.SplitHostPort(h.RemoteAddr)
+	if err != nil {
+		ip = h.RemoteAddr
+	}
+	return ratelimit.Keys(h.Context(), ip)
+}
+
+func writeRateLimited(rw http.ResponseWriter, retryAfter time.Duration, detail string) {
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeProblem(rw, http.StatusTooManyRequests, CodeRateLimited, detail)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"followers-service.xws.com/repo"
+	"github.com/gorilla/mux"
+)
+
+type SpamHandler struct {
+	logger *log.Logger
+	repo   *repo.FollowRepo
+}
+
+func NewSpamHandler(l *log.Logger, r *repo.FollowRepo) *SpamHandler {
+	return &SpamHandler{l, r}
+}
+
+// GetSuspiciousUsers lists the users flagged by the spam detector.
+func (s *SpamHandler) GetSuspiciousUsers(rw http.ResponseWriter, r *http.Request) {
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+
+	users, err := s.repo.GetSuspiciousUsers(r.Context(), options)
+	if err != nil {
+		s.logger.Println("Error fetching suspicious users:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(users); err != nil {
+		s.logger.Println("Error encoding JSON response:", err)
+	}
+}
+
+// ClearSuspiciousUser lifts the flag of a user wrongly taken for a spammer.
+func (s *SpamHandler) ClearSuspiciousUser(rw http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+
+	if err := s.repo.ClearSuspiciousUser(r.Context(), userID); err != nil {
+		s.logger.Println("Error clearing suspicious user:", err)
+		writeError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/stream"
+	"github.com/gorilla/mux"
+)
+
+const streamKeepAlive = 15 * time.Second
+
+type StreamHandler struct {
+	logger *log.Logger
+	hub    *stream.Hub
+}
+
+func NewStreamHandler(l *log.Logger, h *stream.Hub) *StreamHandler {
+	return &StreamHandler{l, h}
+}
+
+// StreamUserEvents pushes the follow and unfollow events of a user as
+// Server-Sent Events, with the event ID as the SSE id. Clients resume after a
+// disconnect, on any replica, by sending the last ID they saw in the
+// Last-Event-ID header.
+func (s *StreamHandler) StreamUserEvents(rw http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		writeBadRequest(rw, "Invalid user ID")
+		return
+	}
+	// The stream carries the same follows as the history, so it is limited
+	// to the user and admins too
+	if err := auth.AuthorizeFor(r.Context(), userID); err != nil {
+		writeError(rw, err)
+		return
+	}
+	controller := http.NewResponseController(rw)
+	missed, entries, cancel := s.hub.Subscribe(userID, r.Header.Get("Last-Event-ID"))
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, entry := range missed {
+		if err := s.writeEntry(rw, controller, entry); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		s.logger.Println("Error flushing event stream:", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			if err := s.writeEntry(rw, controller, entry); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			controller.SetWriteDeadline(time.Now().Add(streamKeepAlive))
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *StreamHandler) writeEntry(rw http.ResponseWriter, controller *http.ResponseController, entry stream.Entry) error {
+	// The server-wide write timeout is far too short for a stream, so every
+	// write pushes the deadline forward
+	controller.SetWriteDeadline(time.Now().Add(streamKeepAlive))
+	_, err := fmt.Fprintf(rw, "id: %s\nevent: %s\ndata: %s\n\n", entry.Event.Id, entry.Event.Type, entry.Event.Data)
+	if err != nil {
+		s.logger.Println("Error writing event stream:", err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// MiddlewareTracing starts a span for every request, continuing the trace
+// of the caller's traceparent (or uber-trace-id) header when there is one.
+// Handlers pass the request context on, so repository calls become child
+// spans.
+func MiddlewareTracing(tracer opentracing.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+			parent, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h.Header))
+			span := tracer.StartSpan(h.Method+" "+routeTemplate(h), ext.RPCServerOption(parent))
+			defer span.Finish()
+
+			ext.Component.Set(span, "net/http")
+			ext.HTTPMethod.Set(span, h.Method)
+			ext.HTTPUrl.Set(span, h.URL.Path)
+			if id := RequestID(h.Context()); id != "" {
+				span.SetTag("request.id", id)
+			}
+
+			recorder := &statusRecorder{ResponseWriter: rw}
+			next.ServeHTTP(recorder, h.WithContext(opentracing.ContextWithSpan(h.Context(), span)))
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			ext.HTTPStatusCode.Set(span, uint16(recorder.status))
+			if recorder.status >= http.StatusInternalServerError {
+				ext.Error.Set(span, true)
+			}
+		})
+	}
+}
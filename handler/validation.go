@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"followers-service.xws.com/api"
+	"followers-service.xws.com/model"
+	"github.com/gorilla/mux"
+)
+
+// MiddlewareValidatePathIds rejects requests whose user ID path variables
+// (user_id, other_id, followedId, ...) are not positive integers, as required
+// by the OpenAPI document.
+func MiddlewareValidatePathIds(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		var fields model.ValidationErrors
+		for name, value := range mux.Vars(h) {
+			if !strings.HasSuffix(name, "_id") && !strings.HasSuffix(name, "Id") {
+				continue
+			}
+			if id, err := strconv.Atoi(value); err != nil || id <= 0 {
+				fields = append(fields, model.FieldError{Field: name, Message: "must be a positive integer"})
+			}
+		}
+		if fields != nil {
+			writeBadRequest(rw, "Validation failed", fields...)
+			return
+		}
+		next.ServeHTTP(rw, h)
+	})
+}
+
+func ServeOpenAPI(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(api.Spec)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/model"
+	"followers-service.xws.com/repo"
+	"github.com/gorilla/mux"
+)
+
+type WebhooksHandler struct {
+	logger *log.Logger
+	repo   *repo.FollowRepo
+}
+
+func NewWebhooksHandler(l *log.Logger, r *repo.FollowRepo) *WebhooksHandler {
+	return &WebhooksHandler{l, r}
+}
+
+func (w *WebhooksHandler) AddWebhook(rw http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value(KeyProduct{}).(*model.Webhook)
+
+	target, err := url.Parse(webhook.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeBadRequest(rw, "url must be an absolute http or https URL")
+		return
+	}
+	if len(webhook.EventTypes) == 0 {
+		writeBadRequest(rw, "eventTypes must not be empty")
+		return
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !isEventType(eventType) {
+			writeBadRequest(rw, "Unknown event type "+eventType)
+			return
+		}
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			w.logger.Println("Error generating webhook secret:", err)
+			writeError(rw, err)
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	saved, err := w.repo.AddWebhook(r.Context(), webhook)
+	if err != nil {
+		w.logger.Println("Error creating webhook:", err)
+		writeError(rw, err)
+		return
+	}
+
+	// The secret is only ever shown in the creation response
+	rw.WriteHeader(http.StatusCreated)
+	if err := saved.ToJSON(rw); err != nil {
+		w.logger.Println("Error encoding JSON response:", err)
+	}
+}
+
+func (w *WebhooksHandler) GetWebhooks(rw http.ResponseWriter, r *http.Request) {
+	webhooks, err := w.repo.GetWebhooks(r.Context())
+	if err != nil {
+		w.logger.Println("Error fetching webhooks:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(webhooks); err != nil {
+		w.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (w *WebhooksHandler) DeleteWebhook(rw http.ResponseWriter, r *http.Request) {
+	err := w.repo.DeleteWebhook(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		w.logger.Println("Error deleting webhook:", err)
+		writeError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// EnableWebhook re-enables a webhook that was disabled after failing too often.
+func (w *WebhooksHandler) EnableWebhook(rw http.ResponseWriter, r *http.Request) {
+	err := w.repo.SetWebhookActive(r.Context(), mux.Vars(r)["id"], true)
+	if err != nil {
+		w.logger.Println("Error enabling webhook:", err)
+		writeError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (w *WebhooksHandler) GetWebhookDeliveries(rw http.ResponseWriter, r *http.Request) {
+	options, err := parseListOptions(r)
+	if err != nil {
+		writeBadRequest(rw, err.Error())
+		return
+	}
+
+	deliveries, err := w.repo.GetWebhookDeliveries(r.Context(), mux.Vars(r)["id"], options)
+	if err != nil {
+		w.logger.Println("Error fetching webhook deliveries:", err)
+		writeError(rw, err)
+		return
+	}
+
+	if err := json.NewEncoder(rw).Encode(deliveries); err != nil {
+		w.logger.Println("Error encoding JSON response:", err)
+		writeError(rw, err)
+		return
+	}
+}
+
+func (w *WebhooksHandler) MiddlewareWebhookDeserialization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
+		webhook := &model.Webhook{}
+		err := webhook.FromJSON(h.Body)
+		if err != nil {
+			writeDecodeError(rw, err)
+			return
+		}
+		ctx := context.WithValue(h.Context(), KeyProduct{}, webhook)
+		h = h.WithContext(ctx)
+		next.ServeHTTP(rw, h)
+	})
+}
+
+func isEventType(eventType string) bool {
+	for _, known := range events.Types {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -3,15 +3,29 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"time"
 
+	"followers-service.xws.com/analytics"
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/graph"
+	"followers-service.xws.com/grpcapi"
 	"followers-service.xws.com/handler"
+	"followers-service.xws.com/metrics"
+	"followers-service.xws.com/outbox"
+	"followers-service.xws.com/ratelimit"
 	"followers-service.xws.com/repo"
+	"followers-service.xws.com/spam"
+	"followers-service.xws.com/stream"
+	"followers-service.xws.com/tracing"
+	"followers-service.xws.com/webhooks"
 
 	gorillaHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -28,6 +42,10 @@ func main() {
 	if len(port) == 0 {
 		port = "8086"
 	}
+	grpcPort := os.Getenv("GRPC_PORT")
+	if len(grpcPort) == 0 {
+		grpcPort = "8087"
+	}
 
 	// Initialize context
 	timeoutContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -37,6 +55,14 @@ func main() {
 	logger := log.New(os.Stdout, "[followers-api] ", log.LstdFlags)
 	followLogger := log.New(os.Stdout, "[follow-store] ", log.LstdFlags)
 
+	// Tracing: spans go to a local Jaeger agent or collector, or to stdout
+	tracingLogger := log.New(os.Stdout, "[followers-tracing] ", log.LstdFlags)
+	tracer, tracingCloser, err := tracing.Init("followers-service", tracingLogger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tracingCloser.Close()
+
 	// NoSQL: Initialize Repository stores
 	fstore, err := repo.NewFollowsStore(followLogger)
 	if err != nil {
@@ -44,20 +70,125 @@ func main() {
 	}
 	defer fstore.CloseDriverConnection(timeoutContext)
 	fstore.CheckConnection()
+	if err := fstore.EnsureIndexes(); err != nil {
+		logger.Fatal(err)
+	}
 	//------------------------------------------------------------
 	followLogger.Println("I AM IN MAIN")
 
+	// Events: publish to NATS when a broker is configured, otherwise keep them in-process
+	eventLogger := log.New(os.Stdout, "[follow-events] ", log.LstdFlags)
+	// The live streams are fed from the broker rather than by the relay, since
+	// with several replicas each event is relayed by only one of them
+	hub := stream.NewHub(1000)
+	toHub := func(event events.Event) {
+		if err := hub.Publish(context.Background(), event); err != nil {
+			eventLogger.Println("Error streaming event:", err)
+		}
+	}
+	publisher := events.NewMultiPublisher()
+	if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		nats, err := events.NewNatsPublisher(natsURL, "followers", eventLogger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if err := nats.Subscribe(toHub); err != nil {
+			logger.Fatal(err)
+		}
+		publisher.Add("nats", nats)
+	} else {
+		loopback := events.NewLoopbackPublisher()
+		loopback.Subscribe(func(event events.Event) {
+			eventLogger.Println(event.Type, string(event.Data))
+		})
+		loopback.Subscribe(toHub)
+		publisher.Add("loopback", loopback)
+	}
+	dispatcher := webhooks.NewDispatcher(fstore, eventLogger)
+	publisher.Add("webhooks", dispatcher)
+	defer publisher.Close()
+	defer hub.Close()
+
+	// Relay events written to the outbox by the store
+	backgroundContext, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	relay := outbox.NewRelay(fstore, publisher, eventLogger)
+	go relay.Run(backgroundContext)
+	go dispatcher.Run(backgroundContext)
+
+	// Keep the daily follower growth rollups current
+	go analytics.NewRollupJob(fstore, followLogger).Run(backgroundContext)
+
+	// Graph size gauges for /metrics
+	go metrics.RunGraphGauges(backgroundContext, fstore, followLogger, time.Minute)
+
+	// Flag users who follow and unfollow in bulk and shadow-limit their follows
+	spamLogger := log.New(os.Stdout, "[follow-spam] ", log.LstdFlags)
+	go spam.NewDetector(fstore, spamLogger, spam.DefaultThresholds).Run(backgroundContext)
+
+	// Rate limits: per caller and per address budgets, kept in memory
+	rateLimitConfig, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rateLimitStore := ratelimit.NewMemoryStore()
+	go rateLimitStore.Run(backgroundContext, time.Minute, 10*time.Minute)
+	limiter := ratelimit.NewLimiter(rateLimitStore, rateLimitConfig)
+
 	//Initialize the handlers and inject said logger
 	//moviesHandler := handlers.NewMoviesHandler(logger, store)
-	followsHandler := handler.NewFollowsHandler(followLogger, fstore)
+	followsHandler := handler.NewFollowsHandler(followLogger, fstore, limiter)
+	outboxHandler := handler.NewOutboxHandler(eventLogger, relay)
+	webhooksHandler := handler.NewWebhooksHandler(eventLogger, fstore)
+	streamHandler := handler.NewStreamHandler(eventLogger, hub)
+	audienceHandler := handler.NewAudienceHandler(followLogger, fstore)
+	spamHandler := handler.NewSpamHandler(spamLogger, fstore)
+
+	schema, err := graph.NewSchema(fstore, limiter, followLogger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	graphQLHandler := handler.NewGraphQLHandler(followLogger, schema, graph.Limits{MaxDepth: 8, MaxComplexity: 5000})
+
+	// Authentication: bearer tokens identify the caller of follow and unfollow
+	authLogger := log.New(os.Stdout, "[followers-auth] ", log.LstdFlags)
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if !authConfig.Enabled() {
+		authLogger.Println("No JWT keys configured, requests acting for a user will be rejected")
+	}
+	verifier := auth.NewVerifier(authConfig)
+	apiKeys, err := auth.NewKeyStoreFromEnv(authLogger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	authLogger.Printf("%d service API keys configured", apiKeys.Len())
+	go apiKeys.Watch(backgroundContext, 30*time.Second)
+	usersWrite := handler.MiddlewareRequireScope(auth.ScopeUsersWrite)
+	graphRead := handler.MiddlewareRequireScope(auth.ScopeGraphRead)
+	adminOnly := handler.MiddlewareRequireScope(auth.ScopeAdmin)
 
 	//Initialize the router and add a middleware for all the requests
 	router := mux.NewRouter()
+	router.Use(handler.MiddlewareMetrics, handler.MiddlewareRequestID, handler.MiddlewareTracing(tracer), handler.MiddlewareRecover(followLogger), handler.MiddlewareLimitBody)
+	router.Use(handler.MiddlewareAuthenticate(authLogger, verifier, apiKeys))
+	router.Use(handler.MiddlewareRateLimit(logger, limiter))
+	router.Use(handler.MiddlewareValidatePathIds)
+
+	router.Handle("/openapi.json", http.HandlerFunc(handler.ServeOpenAPI)).Methods(http.MethodGet)
+	router.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
 
 	//Follows API
 
 	// Define subrouter for POST /user
-	router.Handle("/user", followsHandler.MiddlewareContentTypeSet(followsHandler.MiddlewareUserDeserialization(http.HandlerFunc(followsHandler.AddUser)))).Methods(http.MethodPost)
+	router.Handle("/user", usersWrite(followsHandler.MiddlewareContentTypeSet(followsHandler.MiddlewareUserDeserialization(http.HandlerFunc(followsHandler.AddUser))))).Methods(http.MethodPost)
+
+	// Define subrouter for PUT/PATCH/DELETE /user/{user_id}
+	router.Handle("/user/{user_id}", followsHandler.MiddlewareContentTypeSet(followsHandler.MiddlewareUserDeserialization(http.HandlerFunc(followsHandler.UpdateUser)))).Methods(http.MethodPut)
+	router.Handle("/user/{user_id}", followsHandler.MiddlewareContentTypeSet(followsHandler.MiddlewareUserPatchDeserialization(http.HandlerFunc(followsHandler.PatchUser)))).Methods(http.MethodPatch)
+	router.Handle("/user/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.DeleteUser))).Methods(http.MethodDelete)
 
 	// Define subrouter for POST /follows
 	router.Handle("/follows", followsHandler.MiddlewareContentTypeSet(followsHandler.MiddlewareFollowDeserialization(http.HandlerFunc(followsHandler.FollowUser)))).Methods(http.MethodPost)
@@ -69,18 +200,43 @@ func main() {
 	// Define subrouter for GET /user/{user_id}/following
 	router.Handle("/user/following/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetUserFollowing))).Methods(http.MethodGet)
 	router.Handle("/user/followers/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetUserFollowers))).Methods(http.MethodGet)
+	router.Handle("/user/following/{user_id}/common/{other_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetCommonFollowing))).Methods(http.MethodGet)
+	router.Handle("/user/followers/{user_id}/not-following/{other_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetFollowersNotFollowing))).Methods(http.MethodGet)
+	router.Handle("/user/followers/{user_id}/known-by/{viewer_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetFollowersYouKnow))).Methods(http.MethodGet)
 	router.Handle("/user/following-ids/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetUserFollowingIds))).Methods(http.MethodGet)
 	router.Handle("/user/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetUserFollowing))).Methods(http.MethodGet)
+	router.Handle("/user/{user_id}/history", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetUserHistory))).Methods(http.MethodGet)
+	router.Handle("/user/{user_id}/analytics/followers", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetFollowerGrowth))).Methods(http.MethodGet)
+	router.Handle("/user/{user_id}/audience", graphRead(http.HandlerFunc(audienceHandler.GetAudience))).Methods(http.MethodGet)
+	router.Handle("/audience", graphRead(audienceHandler.MiddlewareAudienceDeserialization(http.HandlerFunc(audienceHandler.GetBatchAudience)))).Methods(http.MethodPost)
+	router.Handle("/user/{user_id}/events", http.HandlerFunc(streamHandler.StreamUserEvents)).Methods(http.MethodGet)
+
+	router.Handle("/users/search", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.SearchUsers))).Methods(http.MethodGet)
 
 	router.Handle("/recommendation/{user_id}", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(followsHandler.GetFollowingRecommendation))).Methods(http.MethodGet)
 
+	router.Handle("/graphql", followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(graphQLHandler.ServeGraphQL))).Methods(http.MethodGet, http.MethodPost)
+
+	router.Handle("/admin/outbox", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(outboxHandler.GetOutboxStats)))).Methods(http.MethodGet)
+
+	router.Handle("/admin/suspicious", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(spamHandler.GetSuspiciousUsers)))).Methods(http.MethodGet)
+	router.Handle("/admin/suspicious/{user_id}", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(spamHandler.ClearSuspiciousUser)))).Methods(http.MethodDelete)
+
+	// Webhook subscriptions
+	router.Handle("/admin/webhooks", adminOnly(followsHandler.MiddlewareContentTypeSet(webhooksHandler.MiddlewareWebhookDeserialization(http.HandlerFunc(webhooksHandler.AddWebhook))))).Methods(http.MethodPost)
+	router.Handle("/admin/webhooks", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(webhooksHandler.GetWebhooks)))).Methods(http.MethodGet)
+	router.Handle("/admin/webhooks/{id}", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(webhooksHandler.DeleteWebhook)))).Methods(http.MethodDelete)
+	router.Handle("/admin/webhooks/{id}/enable", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(webhooksHandler.EnableWebhook)))).Methods(http.MethodPost)
+	router.Handle("/admin/webhooks/{id}/deliveries", adminOnly(followsHandler.MiddlewareContentTypeSet(http.HandlerFunc(webhooksHandler.GetWebhookDeliveries)))).Methods(http.MethodGet)
+
 	router.Handle("/test", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		followLogger.Println("I AM IN TEST")
 		rw.WriteHeader(http.StatusOK)
 	})).Methods(http.MethodGet)
 
 	//CORS
-	cors := gorillaHandlers.CORS(gorillaHandlers.AllowedOrigins([]string{"*"}))
+	cors := gorillaHandlers.CORS(gorillaHandlers.AllowedOrigins([]string{"*"}),
+		gorillaHandlers.AllowedHeaders([]string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "traceparent", "uber-trace-id"}))
 
 	//Initialize the server
 	server := http.Server{
@@ -91,6 +247,21 @@ func main() {
 		WriteTimeout: 5 * time.Second,
 	}
 
+	// gRPC API on its own port, sharing the same store
+	grpcLogger := log.New(os.Stdout, "[followers-grpc] ", log.LstdFlags)
+	grpcServer := grpcapi.NewGRPCServer(grpcapi.NewFollowersServer(grpcLogger, fstore, limiter), verifier, apiKeys)
+	listener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	go func() {
+		grpcLogger.Println("gRPC server listening on port", grpcPort)
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Fatal(err)
+		}
+	}()
+	defer grpcServer.GracefulStop()
+
 	logger.Println("Server listening on port", port)
 
 	serverError := server.ListenAndServe()
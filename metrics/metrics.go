@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "followers"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "neo4j_query_duration_seconds",
+		Help:      "Duration of Neo4j sessions by repository method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "neo4j_errors_total",
+		Help:      "Failed Neo4j sessions and transactions by repository method.",
+	}, []string{"method"})
+
+	users = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "users",
+		Help:      "Number of users in the graph.",
+	})
+
+	followEdges = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "follow_edges",
+		Help:      "Number of FOLLOWS relationships in the graph.",
+	})
+)
+
+// ObserveRequest records a served HTTP request. route is the mux path
+// template so that IDs do not create a series each.
+func ObserveRequest(route string, method string, code string, duration time.Duration) {
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveQuery records a Neo4j session run by a repository method that
+// started at start and ended with err.
+func ObserveQuery(method string, start time.Time, err error) {
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// GraphStore is the part of the repository the size gauges are read from.
+type GraphStore interface {
+	GetGraphTotals(ctx context.Context) (int64, int64, error)
+}
+
+// RunGraphGauges refreshes the user and follow edge gauges every interval
+// until ctx is cancelled. Counting the whole graph is too slow to do on each
+// scrape.
+func RunGraphGauges(ctx context.Context, store GraphStore, logger *log.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		userCount, edgeCount, err := store.GetGraphTotals(ctx)
+		if err != nil {
+			logger.Println("Error refreshing graph gauges:", err)
+		} else {
+			users.Set(float64(userCount))
+			followEdges.Set(float64(edgeCount))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
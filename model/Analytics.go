@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// DailyGrowth counts the followers a user gained and lost on one UTC day.
+type DailyGrowth struct {
+	Day    time.Time
+	Gained int
+	Lost   int
+}
+
+type GrowthBucket struct {
+	Start  time.Time `json:"start"`
+	Gained int       `json:"gained"`
+	Lost   int       `json:"lost"`
+	Net    int       `json:"net"`
+}
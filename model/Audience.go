@@ -0,0 +1,23 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// AudienceRequest asks for the followers of several authors at once.
+type AudienceRequest struct {
+	AuthorIDs []int `json:"authorIDs"`
+}
+
+// AudienceMember is one line of the NDJSON audience stream.
+type AudienceMember struct {
+	AuthorID   int `json:"authorID,omitempty"`
+	FollowerID int `json:"followerID"`
+}
+
+func (o *AudienceRequest) FromJSON(r io.Reader) error {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	return d.Decode(o)
+}
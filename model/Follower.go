@@ -18,5 +18,6 @@ func (o *Follows) ToJSON(w io.Writer) error {
 }
 func (o *Follow) FromJSON(r io.Reader) error {
 	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
 	return d.Decode(o)
 }
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// The history only has follow actions: the service has no blocks or follow
+// approvals to record.
+const (
+	ActionFollow   = "follow"
+	ActionUnfollow = "unfollow"
+)
+
+// HistoryEntry records a follow or unfollow. ActorID is the user who made the
+// change, usually the follower but an admin when acting for them. Changes made
+// with a service API key have no ActorID and carry the key's ID instead.
+type HistoryEntry struct {
+	Action     string    `json:"action"`
+	ActorID    int       `json:"actorID,omitempty"`
+	ActorKeyID string    `json:"actorKeyID,omitempty"`
+	FollowerID int       `json:"followerID"`
+	FollowedID int       `json:"followedID"`
+	At         time.Time `json:"at"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// FollowActivity sums up what a user did over a detection window. Churned
+// counts the users they both followed and unfollowed in that window.
+type FollowActivity struct {
+	UserID    int `json:"userID"`
+	Follows   int `json:"follows"`
+	Unfollows int `json:"unfollows"`
+	Churned   int `json:"churned"`
+}
+
+// SuspiciousUser is a user the spam detector flagged. While LimitedUntil is
+// in the future their follows are shadow-limited.
+type SuspiciousUser struct {
+	FollowActivity
+	Username     string    `json:"username,omitempty"`
+	Reason       string    `json:"reason"`
+	FlaggedAt    time.Time `json:"flaggedAt"`
+	LimitedUntil time.Time `json:"limitedUntil"`
+}
@@ -6,17 +6,36 @@ import (
 )
 
 type User struct {
-	Id       int    `json:"Id"`
-	Username string `json:"Username"`
+	Id          int    `json:"Id"`
+	Username    string `json:"Username"`
+	DisplayName string `json:"displayName,omitempty"`
+	AvatarUrl   string `json:"avatarUrl,omitempty"`
+	Role        string `json:"role,omitempty"`
 }
 
 type Users []*User
 
+// UserPatch is the body of PATCH /user/{id}. Fields that are absent stay as
+// they are, and fields set to "" are cleared.
+type UserPatch struct {
+	Username    *string `json:"Username"`
+	DisplayName *string `json:"displayName"`
+	AvatarUrl   *string `json:"avatarUrl"`
+	Role        *string `json:"role"`
+}
+
 func (o *User) ToJSON(w io.Writer) error {
 	e := json.NewEncoder(w)
 	return e.Encode(o)
 }
 func (o *User) FromJSON(r io.Reader) error {
 	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	return d.Decode(o)
+}
+
+func (o *UserPatch) FromJSON(r io.Reader) error {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
 	return d.Decode(o)
 }
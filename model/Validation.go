@@ -0,0 +1,57 @@
+package model
+
+import "strings"
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, fieldError := range v {
+		messages = append(messages, fieldError.Field+" "+fieldError.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Validate checks that both sides of the follow are set.
+func (o *Follow) Validate() error {
+	var errs ValidationErrors
+	if o.FollowerID <= 0 {
+		errs = append(errs, FieldError{"followerID", "must be a positive integer"})
+	}
+	if o.FollowedID <= 0 {
+		errs = append(errs, FieldError{"followedID", "must be a positive integer"})
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the fields required to create a user.
+func (o *User) Validate() error {
+	var errs ValidationErrors
+	if o.Id <= 0 {
+		errs = append(errs, FieldError{"Id", "must be a positive integer"})
+	}
+	if strings.TrimSpace(o.Username) == "" {
+		errs = append(errs, FieldError{"Username", "is required"})
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks that the patch does not clear the username.
+func (o *UserPatch) Validate() error {
+	if o.Username != nil && strings.TrimSpace(*o.Username) == "" {
+		return ValidationErrors{{"Username", "must not be empty"}}
+	}
+	return nil
+}
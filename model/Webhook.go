@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type Webhook struct {
+	Id                  string    `json:"id"`
+	Url                 string    `json:"url"`
+	EventTypes          []string  `json:"eventTypes"`
+	Secret              string    `json:"secret,omitempty"`
+	Active              bool      `json:"active"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	CreatedAt           time.Time `json:"createdAt"`
+}
+
+type Webhooks []*Webhook
+
+type WebhookDelivery struct {
+	Id         string    `json:"id"`
+	WebhookId  string    `json:"webhookId"`
+	EventId    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	AttemptAt  time.Time `json:"attemptAt"`
+}
+
+func (o *Webhook) ToJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	return e.Encode(o)
+}
+func (o *Webhook) FromJSON(r io.Reader) error {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	return d.Decode(o)
+}
@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/repo"
+	"followers-service.xws.com/tracing"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// Store holds the outbox: the relay leases due events from it, reports back
+// how each attempt went and prunes what has been delivered.
+type Store interface {
+	ClaimPendingEvents(ctx context.Context, owner string, limit int, leaseFor time.Duration) ([]repo.PendingEvent, error)
+	MarkEventDelivered(ctx context.Context, eventId string) error
+	MarkEventFailed(ctx context.Context, eventId string, publishedTo []string, lastError string, nextAttemptAt time.Time) error
+	MarkEventDead(ctx context.Context, eventId string, publishedTo []string, lastError string) error
+	PruneDeliveredEvents(ctx context.Context, before time.Time) error
+	GetOutboxLag(ctx context.Context) (repo.OutboxLag, error)
+}
+
+// Publisher hands an event to several destinations, skipping those in done,
+// and reports which of them have it. events.MultiPublisher is one.
+type Publisher interface {
+	PublishExcept(ctx context.Context, event events.Event, done []string) ([]string, error)
+}
+
+// Stats is a snapshot of the relay's progress, served on the admin endpoint.
+type Stats struct {
+	Pending         int64   `json:"pending"`
+	LagSeconds      float64 `json:"lagSeconds"`
+	Delivered       int64   `json:"delivered"`
+	Failed          int64   `json:"failed"`
+	Dead            int64   `json:"dead"`
+	LastRunAt       string  `json:"lastRunAt,omitempty"`
+	LastDeliveryLag float64 `json:"lastDeliveryLagSeconds"`
+}
+
+// Relay moves events from the outbox to the publisher. Each run leases a
+// batch, so several replicas can relay side by side. Events that fail are
+// retried with exponential backoff, only towards the destinations that have
+// not got them yet, and given up as dead after maxAttempts. Delivered events
+// are kept for a day and then pruned.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	logger    *log.Logger
+	owner     string
+
+	interval    time.Duration
+	batchSize   int
+	leaseFor    time.Duration
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+	retainedFor time.Duration
+
+	mu              sync.Mutex
+	delivered       int64
+	failed          int64
+	lastRunAt       time.Time
+	lastDeliveryLag time.Duration
+}
+
+func NewRelay(store Store, publisher Publisher, logger *log.Logger) *Relay {
+	return &Relay{
+		store:       store,
+		publisher:   publisher,
+		logger:      logger,
+		owner:       relayOwner(),
+		interval:    time.Second,
+		batchSize:   100,
+		leaseFor:    time.Minute,
+		baseDelay:   time.Second,
+		maxDelay:    5 * time.Minute,
+		maxAttempts: 20,
+		retainedFor: 24 * time.Hour,
+	}
+}
+
+// relayOwner names this relay in the leases it takes. The random suffix keeps
+// two processes on one host apart.
+func relayOwner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayPending(ctx)
+			if time.Since(lastPrune) > time.Hour {
+				if err := r.store.PruneDeliveredEvents(ctx, time.Now().Add(-r.retainedFor)); err == nil {
+					lastPrune = time.Now()
+				}
+			}
+		}
+	}
+}
+
+func (r *Relay) relayPending(ctx context.Context) {
+	pending, err := r.store.ClaimPendingEvents(ctx, r.owner, r.batchSize, r.leaseFor)
+	if err != nil {
+		return
+	}
+
+	for _, p := range pending {
+		span, publishCtx := tracing.StartSpanFollowing(ctx, "outbox publish "+p.Event.Type, p.Traceparent)
+		span.SetTag("event.id", p.Event.Id)
+		publishedTo, err := r.publisher.PublishExcept(publishCtx, p.Event, p.PublishedTo)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+		if err != nil {
+			r.logger.Printf("Error relaying event %s (attempt %d): %v", p.Event.Id, p.Attempts+1, err)
+			if p.Attempts+1 >= r.maxAttempts {
+				r.logger.Printf("Giving up on event %s after %d attempts", p.Event.Id, p.Attempts+1)
+				err = r.store.MarkEventDead(ctx, p.Event.Id, publishedTo, err.Error())
+			} else {
+				err = r.store.MarkEventFailed(ctx, p.Event.Id, publishedTo, err.Error(), time.Now().Add(r.backoff(p.Attempts)))
+			}
+			if err != nil {
+				return
+			}
+			r.record(0, false)
+			continue
+		}
+		if err := r.store.MarkEventDelivered(ctx, p.Event.Id); err != nil {
+			// The event will be published again on the next run; consumers
+			// deduplicate on the event ID.
+			return
+		}
+		r.record(time.Since(p.Event.OccurredAt), true)
+	}
+
+	r.mu.Lock()
+	r.lastRunAt = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.baseDelay
+	for i := 0; i < attempts && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+	return delay
+}
+
+func (r *Relay) record(lag time.Duration, delivered bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if delivered {
+		r.delivered++
+		r.lastDeliveryLag = lag
+	} else {
+		r.failed++
+	}
+}
+
+// Stats reports the outbox backlog together with the relay's counters.
+func (r *Relay) Stats(ctx context.Context) (Stats, error) {
+	lag, err := r.store.GetOutboxLag(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := Stats{
+		Pending:         lag.Pending,
+		Delivered:       r.delivered,
+		Failed:          r.failed,
+		Dead:            lag.Dead,
+		LastDeliveryLag: r.lastDeliveryLag.Seconds(),
+	}
+	if lag.Pending > 0 && !lag.OldestOccurredAt.IsZero() {
+		stats.LagSeconds = time.Since(lag.OldestOccurredAt).Seconds()
+	}
+	if !r.lastRunAt.IsZero() {
+		stats.LastRunAt = r.lastRunAt.UTC().Format(time.RFC3339)
+	}
+	return stats, nil
+}
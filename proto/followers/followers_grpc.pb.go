@@ -0,0 +1,368 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: followers.proto
+
+package followers
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	FollowersService_AddUser_FullMethodName          = "/followers.FollowersService/AddUser"
+	FollowersService_Follow_FullMethodName           = "/followers.FollowersService/Follow"
+	FollowersService_Unfollow_FullMethodName         = "/followers.FollowersService/Unfollow"
+	FollowersService_CheckFollow_FullMethodName      = "/followers.FollowersService/CheckFollow"
+	FollowersService_ListFollowing_FullMethodName    = "/followers.FollowersService/ListFollowing"
+	FollowersService_ListFollowers_FullMethodName    = "/followers.FollowersService/ListFollowers"
+	FollowersService_ListFollowingIds_FullMethodName = "/followers.FollowersService/ListFollowingIds"
+	FollowersService_Recommend_FullMethodName        = "/followers.FollowersService/Recommend"
+)
+
+// FollowersServiceClient is the client API for FollowersService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FollowersServiceClient interface {
+	AddUser(ctx context.Context, in *AddUserRequest, opts ...grpc.CallOption) (*AddUserResponse, error)
+	Follow(ctx context.Context, in *FollowRequest, opts ...grpc.CallOption) (*FollowResponse, error)
+	Unfollow(ctx context.Context, in *UnfollowRequest, opts ...grpc.CallOption) (*UnfollowResponse, error)
+	CheckFollow(ctx context.Context, in *CheckFollowRequest, opts ...grpc.CallOption) (*CheckFollowResponse, error)
+	ListFollowing(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListFollowsResponse, error)
+	ListFollowers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListFollowsResponse, error)
+	ListFollowingIds(ctx context.Context, in *ListFollowingIdsRequest, opts ...grpc.CallOption) (*ListFollowingIdsResponse, error)
+	Recommend(ctx context.Context, in *RecommendRequest, opts ...grpc.CallOption) (*RecommendResponse, error)
+}
+
+type followersServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFollowersServiceClient(cc grpc.ClientConnInterface) FollowersServiceClient {
+	return &followersServiceClient{cc}
+}
+
+func (c *followersServiceClient) AddUser(ctx context.Context, in *AddUserRequest, opts ...grpc.CallOption) (*AddUserResponse, error) {
+	out := new(AddUserResponse)
+	err := c.cc.Invoke(ctx, FollowersService_AddUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) Follow(ctx context.Context, in *FollowRequest, opts ...grpc.CallOption) (*FollowResponse, error) {
+	out := new(FollowResponse)
+	err := c.cc.Invoke(ctx, FollowersService_Follow_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) Unfollow(ctx context.Context, in *UnfollowRequest, opts ...grpc.CallOption) (*UnfollowResponse, error) {
+	out := new(UnfollowResponse)
+	err := c.cc.Invoke(ctx, FollowersService_Unfollow_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) CheckFollow(ctx context.Context, in *CheckFollowRequest, opts ...grpc.CallOption) (*CheckFollowResponse, error) {
+	out := new(CheckFollowResponse)
+	err := c.cc.Invoke(ctx, FollowersService_CheckFollow_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) ListFollowing(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListFollowsResponse, error) {
+	out := new(ListFollowsResponse)
+	err := c.cc.Invoke(ctx, FollowersService_ListFollowing_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) ListFollowers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListFollowsResponse, error) {
+	out := new(ListFollowsResponse)
+	err := c.cc.Invoke(ctx, FollowersService_ListFollowers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) ListFollowingIds(ctx context.Context, in *ListFollowingIdsRequest, opts ...grpc.CallOption) (*ListFollowingIdsResponse, error) {
+	out := new(ListFollowingIdsResponse)
+	err := c.cc.Invoke(ctx, FollowersService_ListFollowingIds_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followersServiceClient) Recommend(ctx context.Context, in *RecommendRequest, opts ...grpc.CallOption) (*RecommendResponse, error) {
+	out := new(RecommendResponse)
+	err := c.cc.Invoke(ctx, FollowersService_Recommend_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FollowersServiceServer is the server API for FollowersService service.
+// All implementations must embed UnimplementedFollowersServiceServer
+// for forward compatibility
+type FollowersServiceServer interface {
+	AddUser(context.Context, *AddUserRequest) (*AddUserResponse, error)
+	Follow(context.Context, *FollowRequest) (*FollowResponse, error)
+	Unfollow(context.Context, *UnfollowRequest) (*UnfollowResponse, error)
+	CheckFollow(context.Context, *CheckFollowRequest) (*CheckFollowResponse, error)
+	ListFollowing(context.Context, *ListRequest) (*ListFollowsResponse, error)
+	ListFollowers(context.Context, *ListRequest) (*ListFollowsResponse, error)
+	ListFollowingIds(context.Context, *ListFollowingIdsRequest) (*ListFollowingIdsResponse, error)
+	Recommend(context.Context, *RecommendRequest) (*RecommendResponse, error)
+	mustEmbedUnimplementedFollowersServiceServer()
+}
+
+// UnimplementedFollowersServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedFollowersServiceServer struct {
+}
+
+func (UnimplementedFollowersServiceServer) AddUser(context.Context, *AddUserRequest) (*AddUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddUser not implemented")
+}
+func (UnimplementedFollowersServiceServer) Follow(context.Context, *FollowRequest) (*FollowResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Follow not implemented")
+}
+func (UnimplementedFollowersServiceServer) Unfollow(context.Context, *UnfollowRequest) (*UnfollowResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unfollow not implemented")
+}
+func (UnimplementedFollowersServiceServer) CheckFollow(context.Context, *CheckFollowRequest) (*CheckFollowResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckFollow not implemented")
+}
+func (UnimplementedFollowersServiceServer) ListFollowing(context.Context, *ListRequest) (*ListFollowsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFollowing not implemented")
+}
+func (UnimplementedFollowersServiceServer) ListFollowers(context.Context, *ListRequest) (*ListFollowsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFollowers not implemented")
+}
+func (UnimplementedFollowersServiceServer) ListFollowingIds(context.Context, *ListFollowingIdsRequest) (*ListFollowingIdsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFollowingIds not implemented")
+}
+func (UnimplementedFollowersServiceServer) Recommend(context.Context, *RecommendRequest) (*RecommendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Recommend not implemented")
+}
+func (UnimplementedFollowersServiceServer) mustEmbedUnimplementedFollowersServiceServer() {}
+
+// UnsafeFollowersServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FollowersServiceServer will
+// result in compilation errors.
+type UnsafeFollowersServiceServer interface {
+	mustEmbedUnimplementedFollowersServiceServer()
+}
+
+func RegisterFollowersServiceServer(s grpc.ServiceRegistrar, srv FollowersServiceServer) {
+	s.RegisterService(&FollowersService_ServiceDesc, srv)
+}
+
+func _FollowersService_AddUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).AddUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_AddUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).AddUser(ctx, req.(*AddUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_Follow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FollowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).Follow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_Follow_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).Follow(ctx, req.(*FollowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_Unfollow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnfollowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).Unfollow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_Unfollow_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).Unfollow(ctx, req.(*UnfollowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_CheckFollow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckFollowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).CheckFollow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_CheckFollow_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).CheckFollow(ctx, req.(*CheckFollowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_ListFollowing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).ListFollowing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_ListFollowing_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).ListFollowing(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_ListFollowers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).ListFollowers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_ListFollowers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).ListFollowers(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_ListFollowingIds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFollowingIdsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).ListFollowingIds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_ListFollowingIds_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).ListFollowingIds(ctx, req.(*ListFollowingIdsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FollowersService_Recommend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecommendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowersServiceServer).Recommend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FollowersService_Recommend_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowersServiceServer).Recommend(ctx, req.(*RecommendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FollowersService_ServiceDesc is the grpc.ServiceDesc for FollowersService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FollowersService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "followers.FollowersService",
+	HandlerType: (*FollowersServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddUser",
+			Handler:    _FollowersService_AddUser_Handler,
+		},
+		{
+			MethodName: "Follow",
+			Handler:    _FollowersService_Follow_Handler,
+		},
+		{
+			MethodName: "Unfollow",
+			Handler:    _FollowersService_Unfollow_Handler,
+		},
+		{
+			MethodName: "CheckFollow",
+			Handler:    _FollowersService_CheckFollow_Handler,
+		},
+		{
+			MethodName: "ListFollowing",
+			Handler:    _FollowersService_ListFollowing_Handler,
+		},
+		{
+			MethodName: "ListFollowers",
+			Handler:    _FollowersService_ListFollowers_Handler,
+		},
+		{
+			MethodName: "ListFollowingIds",
+			Handler:    _FollowersService_ListFollowingIds_Handler,
+		},
+		{
+			MethodName: "Recommend",
+			Handler:    _FollowersService_Recommend_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "followers.proto",
+}
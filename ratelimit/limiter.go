@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"followers-service.xws.com/auth"
+)
+
+// ErrDailyFollowCap is returned when a user has followed as many users as
+// they may in one day.
+var ErrDailyFollowCap = errors.New("daily follow limit reached")
+
+// Config holds the budgets enforced by a Limiter.
+type Config struct {
+	Read         Limit
+	Write        Limit
+	DailyFollows int
+}
+
+// ConfigFromEnv reads RATE_LIMIT_READ_PER_MINUTE, RATE_LIMIT_WRITE_PER_MINUTE
+// and FOLLOW_DAILY_CAP, falling back to defaults for unset values.
+func ConfigFromEnv() (Config, error) {
+	read, err := intFromEnv("RATE_LIMIT_READ_PER_MINUTE", 600)
+	if err != nil {
+		return Config{}, err
+	}
+	write, err := intFromEnv("RATE_LIMIT_WRITE_PER_MINUTE", 60)
+	if err != nil {
+		return Config{}, err
+	}
+	dailyFollows, err := intFromEnv("FOLLOW_DAILY_CAP", 1000)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{Read: PerMinute(read), Write: PerMinute(write), DailyFollows: dailyFollows}, nil
+}
+
+func intFromEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return n, nil
+}
+
+// Limiter applies the request budgets and the daily follow cap on top of a
+// Store.
+type Limiter struct {
+	store  Store
+	config Config
+}
+
+func NewLimiter(store Store, config Config) *Limiter {
+	return &Limiter{store: store, config: config}
+}
+
+// Keys returns the budgets a request from the client address ip is charged
+// to: the address and, when authenticated, the caller in ctx.
+func Keys(ctx context.Context, ip string) []string {
+	keys := []string{"ip:" + ip}
+	if caller, ok := auth.CallerFrom(ctx); ok {
+		if caller.KeyID != "" {
+			keys = append(keys, "key:"+caller.KeyID)
+		} else {
+			keys = append(keys, "user:"+strconv.Itoa(caller.UserID))
+		}
+	}
+	return keys
+}
+
+// AllowRequest takes a token from the read or write budget of each of keys,
+// as returned by Keys. A request refused by one budget costs none of the
+// others: the tokens already taken are put back.
+func (l *Limiter) AllowRequest(ctx context.Context, keys []string, write bool) (bool, time.Duration, error) {
+	prefix, limit := "read:", l.config.Read
+	if write {
+		prefix, limit = "write:", l.config.Write
+	}
+	for i, key := range keys {
+		allowed, retryAfter, err := l.store.Take(ctx, prefix+key, limit)
+		if err == nil && allowed {
+			continue
+		}
+		for _, taken := range keys[:i] {
+			if err := l.store.Refund(ctx, prefix+taken, limit); err != nil {
+				return false, 0, err
+			}
+		}
+		return allowed, retryAfter, err
+	}
+	return true, 0, nil
+}
+
+// AllowFollow counts a follow by userID against the cap for the current UTC
+// day. It returns ErrDailyFollowCap, and how long until midnight, once the cap
+// is reached. A follow that then fails is handed back with ReleaseFollow, so
+// only follows that were made use up the cap.
+func (l *Limiter) AllowFollow(ctx context.Context, userID int) (time.Duration, error) {
+	allowed, retryAfter, err := l.store.Increment(ctx, followKey(userID), followDay(), 24*time.Hour, l.config.DailyFollows)
+	if err != nil {
+		return 0, err
+	}
+	if !allowed {
+		return retryAfter, ErrDailyFollowCap
+	}
+	return 0, nil
+}
+
+// ReleaseFollow takes back a follow AllowFollow counted for userID today.
+func (l *Limiter) ReleaseFollow(ctx context.Context, userID int) error {
+	return l.store.Release(ctx, followKey(userID), followDay())
+}
+
+func followKey(userID int) string {
+	return "follows:" + strconv.Itoa(userID)
+}
+
+func followDay() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowRequest(t *testing.T) {
+	store, _ := newTestStore(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(store, Config{Read: PerMinute(3), Write: PerMinute(3)})
+	ctx := context.Background()
+
+	// Drain the caller's budget from another address
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := limiter.AllowRequest(ctx, []string{"ip:b", "key:k"}, false); !allowed {
+			t.Fatalf("request %d refused", i)
+		}
+	}
+
+	// Requests the caller's budget refuses do not use up the shared address
+	for i := 0; i < 10; i++ {
+		allowed, retryAfter, err := limiter.AllowRequest(ctx, []string{"ip:a", "key:k"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed || retryAfter != 20*time.Second {
+			t.Fatalf("throttled caller: allowed = %v, retry after %v", allowed, retryAfter)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := limiter.AllowRequest(ctx, []string{"ip:a", "key:other"}, false); !allowed {
+			t.Fatalf("request %d of another caller behind the same address refused", i)
+		}
+	}
+
+	// Reads and writes are budgeted apart
+	if allowed, _, _ := limiter.AllowRequest(ctx, []string{"ip:a", "key:k"}, true); !allowed {
+		t.Fatal("write refused after reads used up the read budget")
+	}
+}
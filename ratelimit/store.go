@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit allowing n requests a minute, all of which may be
+// used at once.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Store keeps the state of the limits. MemoryStore suits a single instance;
+// replicas behind a load balancer need a shared implementation, for example
+// on top of Redis, so that they draw from the same buckets.
+type Store interface {
+	// Take removes a token from the bucket under key. When the bucket is empty
+	// it reports how long until the next token is available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+	// Refund puts back a token Take removed from the bucket under key.
+	Refund(ctx context.Context, key string, limit Limit) error
+	// Increment counts an event under key in the fixed window that started at
+	// windowStart and lasts window, refusing it once max were counted.
+	Increment(ctx context.Context, key string, windowStart time.Time, window time.Duration, max int) (bool, time.Duration, error)
+	// Release takes back an event Increment counted under key in the window
+	// that started at windowStart. It does nothing once that window is over.
+	Release(ctx context.Context, key string, windowStart time.Time) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type counter struct {
+	count       int
+	windowStart time.Time
+	resetAt     time.Time
+}
+
+// MemoryStore is an in-process Store.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	counters map[string]*counter
+	now      func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, counters: map[string]*counter{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+func (s *MemoryStore) Refund(ctx context.Context, key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+1)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, windowStart time.Time, window time.Duration, max int) (bool, time.Duration, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = &counter{windowStart: windowStart, resetAt: windowStart.Add(window)}
+		s.counters[key] = c
+	}
+	if c.count >= max {
+		return false, c.resetAt.Sub(now), nil
+	}
+	c.count++
+	return true, 0, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string, windowStart time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if ok && c.windowStart.Equal(windowStart) && c.count > 0 {
+		c.count--
+	}
+	return nil
+}
+
+// Run drops idle buckets and expired counters every interval until ctx is
+// cancelled. A bucket idle for maxIdle has refilled and can be recreated.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration, maxIdle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, b := range s.buckets {
+				if now.Sub(b.updated) > maxIdle {
+					delete(s.buckets, key)
+				}
+			}
+			for key, c := range s.counters {
+				if !now.Before(c.resetAt) {
+					delete(s.counters, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for MemoryStore.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestStore(start time.Time) (*MemoryStore, *clock) {
+	c := &clock{now: start}
+	store := NewMemoryStore()
+	store.now = c.Now
+	return store, c
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	limit := PerMinute(3) // one token every 20 seconds, burst of 3
+
+	type take struct {
+		after      time.Duration // since start
+		allowed    bool
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name:  "burst is available at once",
+			takes: []take{{0, true, 0}, {0, true, 0}, {0, true, 0}},
+		},
+		{
+			name: "empty bucket reports when the next token arrives",
+			takes: []take{
+				{0, true, 0}, {0, true, 0}, {0, true, 0},
+				{0, false, 20 * time.Second},
+				{5 * time.Second, false, 15 * time.Second},
+			},
+		},
+		{
+			name: "tokens refill at the rate",
+			takes: []take{
+				{0, true, 0}, {0, true, 0}, {0, true, 0},
+				{20 * time.Second, true, 0},
+				{20 * time.Second, false, 20 * time.Second},
+				{40 * time.Second, true, 0},
+			},
+		},
+		{
+			name: "refill stops at the burst",
+			takes: []take{
+				{0, true, 0},
+				{time.Hour, true, 0}, {time.Hour, true, 0}, {time.Hour, true, 0},
+				{time.Hour, false, 20 * time.Second},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, c := newTestStore(start)
+			for i, tk := range test.takes {
+				c.now = start.Add(tk.after)
+				allowed, retryAfter, err := store.Take(context.Background(), "key", limit)
+				if err != nil {
+					t.Fatalf("take %d: %v", i, err)
+				}
+				if allowed != tk.allowed {
+					t.Fatalf("take %d: allowed = %v, want %v", i, allowed, tk.allowed)
+				}
+				if retryAfter.Round(time.Millisecond) != tk.retryAfter {
+					t.Fatalf("take %d: retry after %v, want %v", i, retryAfter, tk.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTakeKeysAreIndependent(t *testing.T) {
+	store, _ := newTestStore(time.Now())
+	limit := PerMinute(1)
+	if allowed, _, _ := store.Take(context.Background(), "a", limit); !allowed {
+		t.Fatal("first take of a refused")
+	}
+	if allowed, _, _ := store.Take(context.Background(), "b", limit); !allowed {
+		t.Fatal("first take of b refused after a was used")
+	}
+}
+
+func TestMemoryStoreIncrement(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		at         time.Time
+		window     time.Time // defaults to the day of at
+		release    bool
+		allowed    bool
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "refuses once max is counted until the window resets",
+			steps: []step{
+				{at: day.Add(time.Hour), allowed: true},
+				{at: day.Add(2 * time.Hour), allowed: true},
+				{at: day.Add(18 * time.Hour), allowed: false, retryAfter: 6 * time.Hour},
+			},
+		},
+		{
+			name: "a new window starts from zero",
+			steps: []step{
+				{at: day.Add(time.Hour), allowed: true},
+				{at: day.Add(2 * time.Hour), allowed: true},
+				{at: day.Add(25 * time.Hour), allowed: true},
+				{at: day.Add(26 * time.Hour), allowed: true},
+				{at: day.Add(27 * time.Hour), allowed: false, retryAfter: 21 * time.Hour},
+			},
+		},
+		{
+			name: "released events are not counted",
+			steps: []step{
+				{at: day.Add(time.Hour), allowed: true},
+				{at: day.Add(2 * time.Hour), allowed: true},
+				{at: day.Add(3 * time.Hour), release: true},
+				{at: day.Add(4 * time.Hour), allowed: true},
+				{at: day.Add(5 * time.Hour), allowed: false, retryAfter: 19 * time.Hour},
+			},
+		},
+		{
+			name: "release does not reach into the next window",
+			steps: []step{
+				{at: day.Add(time.Hour), allowed: true},
+				{at: day.Add(25 * time.Hour), allowed: true},
+				{at: day.Add(26 * time.Hour), allowed: true},
+				{at: day.Add(26 * time.Hour), window: day, release: true},
+				{at: day.Add(27 * time.Hour), allowed: false, retryAfter: 21 * time.Hour},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, c := newTestStore(day)
+			for i, s := range test.steps {
+				c.now = s.at
+				windowStart := s.window
+				if windowStart.IsZero() {
+					windowStart = s.at.Truncate(24 * time.Hour)
+				}
+				if s.release {
+					if err := store.Release(context.Background(), "key", windowStart); err != nil {
+						t.Fatalf("step %d: %v", i, err)
+					}
+					continue
+				}
+				allowed, retryAfter, err := store.Increment(context.Background(), "key", windowStart, 24*time.Hour, 2)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if allowed != s.allowed {
+					t.Fatalf("step %d: allowed = %v, want %v", i, allowed, s.allowed)
+				}
+				if retryAfter != s.retryAfter {
+					t.Fatalf("step %d: retry after %v, want %v", i, retryAfter, s.retryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"followers-service.xws.com/model"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const followerGrowthRollup = "follower_growth"
+
+// RollupFollowerGrowth aggregates the follow history of every day that has
+// not been rolled up yet and ended before until into :FollowerRollup nodes.
+// It returns the number of days it rolled up.
+func (fr *FollowRepo) RollupFollowerGrowth(ctx context.Context, until time.Time) (int, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	untilDay := neo4j.DateOf(until)
+	days, err := fr.executeWrite(ctx, session, "RollupFollowerGrowth",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`OPTIONAL MATCH (s:RollupState {Name: $name})
+				OPTIONAL MATCH (h:FollowHistory)
+				WHERE s IS NULL
+				WITH s.RolledUpTo AS rolledUpTo, min(h.At) AS firstAt
+				RETURN coalesce(rolledUpTo, date(firstAt))`,
+				map[string]interface{}{"name": followerGrowthRollup})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			start, ok := record.Values[0].(neo4j.Date)
+			if !ok || !start.Time().Before(untilDay.Time()) {
+				return 0, nil
+			}
+
+			_, err = transaction.Run(ctx,
+				`MATCH (h:FollowHistory)
+				WHERE h.At >= $start AND h.At < $until
+				WITH h.FollowedId AS userId, date(h.At) AS day,
+					sum(CASE WHEN h.Action = 'follow' THEN 1 ELSE 0 END) AS gained,
+					sum(CASE WHEN h.Action = 'unfollow' THEN 1 ELSE 0 END) AS lost
+				MERGE (r:FollowerRollup {UserId: userId, Day: day})
+				SET r.Gained = gained, r.Lost = lost`,
+				map[string]interface{}{"start": start.Time(), "until": untilDay.Time()})
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = transaction.Run(ctx,
+				`MERGE (s:RollupState {Name: $name})
+				SET s.RolledUpTo = $until`,
+				map[string]interface{}{"name": followerGrowthRollup, "until": untilDay})
+			if err != nil {
+				return nil, err
+			}
+			return int(untilDay.Time().Sub(start.Time()).Hours() / 24), nil
+		})
+	if err != nil {
+		fr.logger.Println("Error rolling up follower growth:", err)
+		return 0, err
+	}
+	return days.(int), nil
+}
+
+// GetFollowerGrowth returns the followers gained and lost per day in
+// [from, to), where from is the start of a UTC day. Rolled-up days are read
+// from their rollups and the remaining days are aggregated from the history
+// on the fly. Days without activity are left out.
+func (fr *FollowRepo) GetFollowerGrowth(ctx context.Context, userId int, from time.Time, to time.Time) ([]model.DailyGrowth, error) {
+	ctx = withUserIDs(ctx, userId)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	growth, err := fr.executeRead(ctx, session, "GetFollowerGrowth",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`OPTIONAL MATCH (s:RollupState {Name: $name})
+				RETURN s.RolledUpTo`,
+				map[string]interface{}{"name": followerGrowthRollup})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			var watermark time.Time
+			if day, ok := record.Values[0].(neo4j.Date); ok {
+				watermark = day.Time()
+			}
+			rolledUpTo := growthSplit(from, to, watermark)
+
+			result, err = transaction.Run(ctx,
+				`MATCH (r:FollowerRollup {UserId: $userId})
+				WHERE r.Day >= $fromDay AND r.Day < $rolledUpToDay
+				RETURN r.Day AS day, r.Gained AS gained, r.Lost AS lost
+				UNION ALL
+				MATCH (h:FollowHistory {FollowedId: $userId})
+				WHERE h.At >= $rolledUpTo AND h.At < $to
+				RETURN date(h.At) AS day,
+					sum(CASE WHEN h.Action = 'follow' THEN 1 ELSE 0 END) AS gained,
+					sum(CASE WHEN h.Action = 'unfollow' THEN 1 ELSE 0 END) AS lost`,
+				map[string]interface{}{"userId": userId, "fromDay": neo4j.DateOf(from),
+					"rolledUpToDay": neo4j.DateOf(rolledUpTo), "rolledUpTo": rolledUpTo, "to": to})
+			if err != nil {
+				return nil, err
+			}
+
+			days := []model.DailyGrowth{}
+			for result.Next(ctx) {
+				record := result.Record()
+				day, _ := record.Values[0].(neo4j.Date)
+				gained, _ := record.Values[1].(int64)
+				lost, _ := record.Values[2].(int64)
+				days = append(days, model.DailyGrowth{Day: day.Time(), Gained: int(gained), Lost: int(lost)})
+			}
+			return days, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting follower growth:", err)
+		return nil, err
+	}
+	return growth.([]model.DailyGrowth), nil
+}
+
+// growthSplit returns where GetFollowerGrowth switches from rollups to
+// history: the rollup watermark, but no later than the start of the day of
+// to, since the rollup of that day would count activity after to, and no
+// earlier than from.
+func growthSplit(from time.Time, to time.Time, watermark time.Time) time.Time {
+	split := watermark
+	if toDay := to.UTC().Truncate(24 * time.Hour); split.After(toDay) {
+		split = toDay
+	}
+	if split.Before(from) {
+		split = from
+	}
+	return split
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrowthSplit(t *testing.T) {
+	day := func(d int, hour int) time.Time {
+		return time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		watermark time.Time
+		want      time.Time
+	}{
+		{
+			name: "watermark inside the range",
+			from: day(1, 0), to: day(10, 12), watermark: day(5, 0),
+			want: day(5, 0),
+		},
+		{
+			name: "nothing rolled up yet",
+			from: day(1, 0), to: day(10, 12), watermark: time.Time{},
+			want: day(1, 0),
+		},
+		{
+			name: "watermark before from",
+			from: day(6, 0), to: day(10, 12), watermark: day(5, 0),
+			want: day(6, 0),
+		},
+		{
+			// The partial day [day 8, to) must come from the history
+			name: "to before the watermark keeps its partial day",
+			from: day(1, 0), to: day(8, 15), watermark: day(12, 0),
+			want: day(8, 0),
+		},
+		{
+			name: "to at midnight before the watermark",
+			from: day(1, 0), to: day(8, 0), watermark: day(12, 0),
+			want: day(8, 0),
+		},
+		{
+			name: "to on the watermark day",
+			from: day(1, 0), to: day(12, 6), watermark: day(12, 0),
+			want: day(12, 0),
+		},
+		{
+			name: "range within one rolled up day",
+			from: day(3, 0), to: day(3, 18), watermark: day(12, 0),
+			want: day(3, 0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := growthSplit(test.from, test.to, test.watermark); !got.Equal(test.want) {
+				t.Fatalf("growthSplit = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
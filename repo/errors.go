@@ -0,0 +1,14 @@
+package repo
+
+import "errors"
+
+// Sentinel errors returned by FollowRepo. Callers compare with errors.Is; the
+// handler and gRPC layers map each of them onto a stable error code.
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrAlreadyFollowing = errors.New("user is already following")
+	ErrSelfFollow       = errors.New("users cannot follow themselves")
+	ErrFollowingLimit   = errors.New("following limit reached")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrNotFlagged       = errors.New("user is not flagged")
+)
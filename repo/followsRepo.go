@@ -3,16 +3,76 @@ package repo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"time"
 
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/metrics"
 	"followers-service.xws.com/model"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
+// ListOptions narrows a follower or following list to usernames starting with
+// Query and pages through it. A zero Limit returns every match.
+type ListOptions struct {
+	Query string
+	Skip  int
+	Limit int
+}
+
+func (o ListOptions) params(userId int) map[string]interface{} {
+	limit := o.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	return map[string]interface{}{"userId": userId, "query": o.Query, "skip": o.Skip, "limit": limit}
+}
+
 type FollowRepo struct {
-	driver neo4j.DriverWithContext
-	logger *log.Logger
+	driver          neo4j.DriverWithContext
+	logger          *log.Logger
+	followingLimits FollowingLimits
+}
+
+// FollowingLimits caps how many users someone may follow. ByRole overrides
+// Default for users with that role. Zero means no limit.
+type FollowingLimits struct {
+	Default int
+	ByRole  map[string]int
+}
+
+func (l FollowingLimits) For(role string) int {
+	if limit, ok := l.ByRole[role]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// followingLimitsFromEnv reads MAX_FOLLOWING and the verified and admin
+// overrides MAX_FOLLOWING_VERIFIED and MAX_FOLLOWING_ADMIN.
+func followingLimitsFromEnv() (FollowingLimits, error) {
+	limits := FollowingLimits{Default: 5000, ByRole: map[string]int{"verified": 20000, "admin": 0}}
+	variables := map[string]string{"MAX_FOLLOWING": "", "MAX_FOLLOWING_VERIFIED": "verified", "MAX_FOLLOWING_ADMIN": "admin"}
+	for name, role := range variables {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return limits, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		if role == "" {
+			limits.Default = limit
+		} else {
+			limits.ByRole[role] = limit
+		}
+	}
+	return limits, nil
 }
 
 func NewFollowsStore(logger *log.Logger) (*FollowRepo, error) {
@@ -26,7 +86,11 @@ func NewFollowsStore(logger *log.Logger) (*FollowRepo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &FollowRepo{driver: driver, logger: logger}, nil
+	followingLimits, err := followingLimitsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &FollowRepo{driver: driver, logger: logger, followingLimits: followingLimits}, nil
 }
 
 func (fr *FollowRepo) CheckConnection() {
@@ -39,35 +103,121 @@ func (fr *FollowRepo) CheckConnection() {
 	fr.logger.Printf(`Neo4J server address: %s`, fr.driver.Target().Host)
 }
 
-func (fr *FollowRepo) CloseDriverConnection(ctx context.Context) {
-	fr.driver.Close(ctx)
-}
-
-func (fr *FollowRepo) FollowUser(followerID int, followedID int) (model.Follow, error) {
+// EnsureIndexes creates the schema indexes the queries rely on. Every
+// statement is idempotent, so it is safe to call on each start-up.
+func (fr *FollowRepo) EnsureIndexes() error {
 	ctx := context.Background()
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	// Check if the relationship already exists
-	exists, err := fr.checkFollowRelationship(ctx, session, followerID, followedID)
-	if err != nil {
-		return model.Follow{}, err
+	statements := []string{
+		`CREATE RANGE INDEX user_id IF NOT EXISTS FOR (u:User) ON (u.Id)`,
+		`CREATE RANGE INDEX user_username IF NOT EXISTS FOR (u:User) ON (u.Username)`,
+		`CREATE RANGE INDEX outbox_event_id IF NOT EXISTS FOR (e:OutboxEvent) ON (e.Id)`,
+		`CREATE RANGE INDEX outbox_event_next_attempt IF NOT EXISTS FOR (e:OutboxEvent) ON (e.NextAttemptAt)`,
+		`CREATE RANGE INDEX webhook_id IF NOT EXISTS FOR (w:Webhook) ON (w.Id)`,
+		`CREATE RANGE INDEX webhook_delivery_attempt_at IF NOT EXISTS FOR (d:WebhookDelivery) ON (d.AttemptAt)`,
+		`CREATE RANGE INDEX follow_history_follower IF NOT EXISTS FOR (h:FollowHistory) ON (h.FollowerId, h.At)`,
+		`CREATE RANGE INDEX follow_history_followed IF NOT EXISTS FOR (h:FollowHistory) ON (h.FollowedId, h.At)`,
+		`CREATE RANGE INDEX follow_history_at IF NOT EXISTS FOR (h:FollowHistory) ON (h.At)`,
+		`CREATE RANGE INDEX follower_rollup IF NOT EXISTS FOR (r:FollowerRollup) ON (r.UserId, r.Day)`,
+		`CREATE RANGE INDEX suspicious_flag_user IF NOT EXISTS FOR (s:SuspiciousFlag) ON (s.UserId)`,
+	}
+	for _, statement := range statements {
+		_, err := fr.executeWrite(ctx, session, "EnsureIndexes",
+			func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+				_, err := transaction.Run(ctx, statement, nil)
+				return nil, err
+			})
+		if err != nil {
+			fr.logger.Println("Error creating index:", err)
+			return err
+		}
 	}
-	if exists {
-		return model.Follow{}, errors.New("relationship already exists")
+	return nil
+}
+
+func (fr *FollowRepo) CloseDriverConnection(ctx context.Context) {
+	fr.driver.Close(ctx)
+}
+
+// FollowUser makes followerID follow followedID. Missing users, self-follows
+// and duplicates are detected inside the write transaction and reported as
+// ErrUserNotFound, ErrSelfFollow and ErrAlreadyFollowing. A follow that would
+// take the follower past the following limit of their role fails with
+// ErrFollowingLimit. Follows by users the
+// spam detector limited are shadow-limited: they succeed but publish no
+// Followed event, so nobody is notified.
+func (fr *FollowRepo) FollowUser(ctx context.Context, followerID int, followedID int) (model.Follow, error) {
+	if followerID == followedID {
+		return model.Follow{}, ErrSelfFollow
 	}
 
-	// Create the relationship
-	_, err = session.ExecuteWrite(ctx,
+	ctx = withUserIDs(ctx, followerID, followedID)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	// Create the relationship and its Followed event in one transaction
+	_, err := fr.executeWrite(ctx, session, "FollowUser",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
-			_, err := transaction.Run(ctx,
+			result, err := transaction.Run(ctx,
+				`OPTIONAL MATCH (follower:User {Id: $followerID})
+				OPTIONAL MATCH (followed:User {Id: $followedID})
+				RETURN follower IS NOT NULL, followed IS NOT NULL,
+					EXISTS { MATCH (s:SuspiciousFlag {UserId: $followerID}) WHERE s.LimitedUntil > datetime() },
+					follower.Role`,
+				map[string]interface{}{"followerID": followerID, "followedID": followedID})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if exists, _ := record.Values[0].(bool); !exists {
+				return nil, fmt.Errorf("follower %d: %w", followerID, ErrUserNotFound)
+			}
+			if exists, _ := record.Values[1].(bool); !exists {
+				return nil, fmt.Errorf("followed user %d: %w", followedID, ErrUserNotFound)
+			}
+			shadowLimited, _ := record.Values[2].(bool)
+			role, _ := record.Values[3].(string)
+
+			// MERGE locks both users, so concurrent follows of the same pair
+			// cannot both create an edge, and the following count taken after
+			// it cannot be raised by a concurrent follow before we commit
+			result, err = transaction.Run(ctx,
 				`MATCH (follower:User {Id: $followerID}), (followed:User {Id: $followedID})
-                CREATE (follower)-[:FOLLOWS]->(followed)`,
+				MERGE (follower)-[r:FOLLOWS]->(followed)
+				ON CREATE SET r.created = true
+				WITH follower, r, coalesce(r.created, false) AS created
+				REMOVE r.created
+				RETURN created, COUNT { (follower)-[:FOLLOWS]->() }`,
 				map[string]interface{}{"followerID": followerID, "followedID": followedID})
 			if err != nil {
 				return nil, err
 			}
-			return nil, nil
+			record, err = result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if created, _ := record.Values[0].(bool); !created {
+				return nil, ErrAlreadyFollowing
+			}
+			// Returning the error rolls the new edge back
+			following, _ := record.Values[1].(int64)
+			if limit := fr.followingLimits.For(role); limit > 0 && following > int64(limit) {
+				return nil, fmt.Errorf("%w (max %d)", ErrFollowingLimit, limit)
+			}
+
+			if err := writeHistoryEntry(ctx, transaction, model.ActionFollow, followerID, followedID); err != nil {
+				return nil, err
+			}
+			if shadowLimited {
+				return nil, nil
+			}
+			return nil, writeOutboxEvent(ctx, transaction, events.Followed,
+				events.FollowData{FollowerID: followerID, FollowedID: followedID})
 		})
 	if err != nil {
 		fr.logger.Println("Error creating follow:", err)
@@ -82,41 +232,12 @@ func (fr *FollowRepo) FollowUser(followerID int, followedID int) (model.Follow,
 	return follow, nil
 }
 
-func (fr *FollowRepo) checkFollowRelationship(ctx context.Context, session neo4j.SessionWithContext, followerID int, followedID int) (bool, error) {
-	result, err := session.ExecuteRead(ctx, func(transaction neo4j.ManagedTransaction) (interface{}, error) {
-		query := `
-			MATCH (follower:User {Id: $followerID})-[:FOLLOWS]->(followed:User {Id: $followedID})
-			RETURN COUNT(*) > 0
-		`
-		params := map[string]interface{}{"followerID": followerID, "followedID": followedID}
-		cursor, err := transaction.Run(ctx, query, params)
-		if err != nil {
-			return nil, err
-		}
-		if cursor.Next(ctx) {
-			record := cursor.Record()
-			exists, ok := record.Values[0].(bool)
-			if !ok {
-				return nil, errors.New("invalid result for follow relationship check")
-			}
-			return exists, nil
-		}
-
-		return false, nil
-	})
-	if err != nil {
-		return false, err
-	}
-
-	return result.(bool), nil
-}
-
-func (fr *FollowRepo) CheckFollow(followerID int, followedID int) (bool, error) {
-	ctx := context.Background()
+func (fr *FollowRepo) CheckFollow(ctx context.Context, followerID int, followedID int) (bool, error) {
+	ctx = withUserIDs(ctx, followerID, followedID)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	result, err := session.ExecuteRead(ctx,
+	result, err := fr.executeRead(ctx, session, "CheckFollow",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (follower:User {Id: $followerID})-[r:FOLLOWS]->(followed:User {Id: $followedID})
@@ -144,47 +265,293 @@ func (fr *FollowRepo) CheckFollow(followerID int, followedID int) (bool, error)
 	return false, nil
 }
 
-func (ur *FollowRepo) AddUser(user *model.User) error {
-	ctx := context.Background()
+func (ur *FollowRepo) AddUser(ctx context.Context, user *model.User) error {
+	ctx = withUserIDs(ctx, user.Id)
 	session := ur.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	savedUser, err := session.ExecuteWrite(ctx,
+	savedUser, err := ur.executeWrite(ctx, session, "AddUser",
 		func(transaction neo4j.ManagedTransaction) (any, error) {
 			result, err := transaction.Run(ctx,
-				"CREATE (u:User) SET u.Id = $id, u.Username = $username RETURN u.Username + ', from node ' + id(u)",
-				map[string]any{"id": user.Id, "username": user.Username})
+				`CREATE (u:User)
+				SET u.Id = $id, u.Username = $username, u.DisplayName = $displayName, u.AvatarUrl = $avatarUrl, u.Role = $role
+				RETURN u.Username + ', from node ' + id(u)`,
+				map[string]any{"id": user.Id, "username": user.Username, "displayName": user.DisplayName,
+					"avatarUrl": user.AvatarUrl, "role": user.Role})
 			if err != nil {
 				return nil, err
 			}
 
-			if result.Next(ctx) {
-				return result.Record().Values[0], nil
+			if !result.Next(ctx) {
+				return nil, result.Err()
 			}
-
-			return nil, result.Err()
+			description := result.Record().Values[0]
+			if err := writeOutboxEvent(ctx, transaction, events.UserCreated, userData(user)); err != nil {
+				return nil, err
+			}
+			return description, nil
 		})
 	if err != nil {
 		ur.logger.Println("Error inserting User:", err)
 		return err
 	}
 	if savedUser != nil {
-		ur.logger.Println(savedUser.(string))
+		ur.logger.Println(savedUser)
 	}
 	return nil
 }
 
-func (fr *FollowRepo) GetUserFollowing(userId int) ([]model.Follow, error) {
-	ctx := context.Background()
+func (ur *FollowRepo) GetUser(ctx context.Context, userId int) (*model.User, error) {
+	users, err := ur.GetUsersByIds(ctx, []int64{int64(userId)})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &users[0], nil
+}
+
+// GetUsersByIds loads the users with the given IDs in the order of ids.
+// Unknown IDs are skipped.
+func (ur *FollowRepo) GetUsersByIds(ctx context.Context, ids []int64) ([]model.User, error) {
+	session := ur.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	users, err := ur.executeRead(ctx, session, "GetUsersByIds",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`UNWIND range(0, size($ids) - 1) AS i
+				MATCH (u:User {Id: $ids[i]})
+				RETURN u
+				ORDER BY i`,
+				map[string]interface{}{"ids": ids})
+			if err != nil {
+				return nil, err
+			}
+
+			userList := []model.User{}
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				userList = append(userList, userFromNode(node))
+			}
+			return userList, result.Err()
+		})
+	if err != nil {
+		ur.logger.Println("Error getting users:", err)
+		return nil, err
+	}
+	return users.([]model.User), nil
+}
+
+// GetFollowCounts returns how many followers the user has and how many users
+// they follow.
+func (ur *FollowRepo) GetFollowCounts(ctx context.Context, userId int) (int64, int64, error) {
+	ctx = withUserIDs(ctx, userId)
+	session := ur.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	counts, err := ur.executeRead(ctx, session, "GetFollowCounts",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (u:User {Id: $userId})
+				RETURN COUNT { (u)<-[:FOLLOWS]-(:User) }, COUNT { (u)-[:FOLLOWS]->(:User) }`,
+				map[string]interface{}{"userId": userId})
+			if err != nil {
+				return nil, err
+			}
+
+			if !result.Next(ctx) {
+				if err := result.Err(); err != nil {
+					return nil, err
+				}
+				return nil, ErrUserNotFound
+			}
+			values := result.Record().Values
+			followers, _ := values[0].(int64)
+			following, _ := values[1].(int64)
+			return [2]int64{followers, following}, nil
+		})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			ur.logger.Println("Error counting follows:", err)
+		}
+		return 0, 0, err
+	}
+	result := counts.([2]int64)
+	return result[0], result[1], nil
+}
+
+// GetGraphTotals returns the number of users and of follow relationships,
+// read from the count store.
+func (fr *FollowRepo) GetGraphTotals(ctx context.Context) (int64, int64, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	totals, err := fr.executeRead(ctx, session, "GetGraphTotals",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`CALL { MATCH (u:User) RETURN count(u) AS users }
+				CALL { MATCH ()-[r:FOLLOWS]->() RETURN count(r) AS edges }
+				RETURN users, edges`, nil)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			users, _ := record.Values[0].(int64)
+			edges, _ := record.Values[1].(int64)
+			return [2]int64{users, edges}, nil
+		})
+	if err != nil {
+		fr.logger.Println("Error counting graph:", err)
+		return 0, 0, err
+	}
+	result := totals.([2]int64)
+	return result[0], result[1], nil
+}
+
+// UpdateUser applies the fields set in patch to the user; an empty value
+// removes the field. PUT passes every field it replaces.
+func (ur *FollowRepo) UpdateUser(ctx context.Context, userId int, patch model.UserPatch) (*model.User, error) {
+	ctx = withUserIDs(ctx, userId)
+	session := ur.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	// Setting a property to null in u += removes it
+	changes := map[string]any{}
+	for property, value := range map[string]*string{"Username": patch.Username,
+		"DisplayName": patch.DisplayName, "AvatarUrl": patch.AvatarUrl, "Role": patch.Role} {
+		if value == nil {
+			continue
+		}
+		if *value == "" {
+			changes[property] = nil
+		} else {
+			changes[property] = *value
+		}
+	}
+
+	updatedUser, err := ur.executeWrite(ctx, session, "UpdateUser",
+		func(transaction neo4j.ManagedTransaction) (any, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (u:User {Id: $id})
+				SET u += $changes
+				RETURN u`,
+				map[string]any{"id": userId, "changes": changes})
+			if err != nil {
+				return nil, err
+			}
+
+			if result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				updated := userFromNode(node)
+				if err := writeOutboxEvent(ctx, transaction, events.UserUpdated, userData(&updated)); err != nil {
+					return nil, err
+				}
+				return &updated, nil
+			}
+
+			return nil, result.Err()
+		})
+	if err != nil {
+		ur.logger.Println("Error updating User:", err)
+		return nil, err
+	}
+	if updatedUser == nil {
+		return nil, ErrUserNotFound
+	}
+	return updatedUser.(*model.User), nil
+}
+
+// DeleteUser removes the user node together with all of its FOLLOWS edges and
+// returns the number of edges that were removed. Every removed edge is
+// recorded in the history and gets an Unfollowed event, as if it had been
+// unfollowed, before the UserDeleted event.
+func (ur *FollowRepo) DeleteUser(ctx context.Context, userId int) (int64, error) {
+	ctx = withUserIDs(ctx, userId)
+	session := ur.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	removedEdges, err := ur.executeWrite(ctx, session, "DeleteUser",
+		func(transaction neo4j.ManagedTransaction) (any, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (u:User {Id: $id})
+				OPTIONAL MATCH (follower:User)-[:FOLLOWS]->(u)
+				WITH u, collect(follower.Id) AS followerIds
+				OPTIONAL MATCH (u)-[:FOLLOWS]->(followed:User)
+				WITH u, followerIds, collect(followed.Id) AS followedIds
+				DETACH DELETE u
+				RETURN followerIds, followedIds`,
+				map[string]any{"id": userId})
+			if err != nil {
+				return nil, err
+			}
+			if !result.Next(ctx) {
+				return nil, result.Err()
+			}
+
+			followerIds, err := recordValue[[]interface{}](result.Record(), 0)
+			if err != nil {
+				return nil, err
+			}
+			followedIds, err := recordValue[[]interface{}](result.Record(), 1)
+			if err != nil {
+				return nil, err
+			}
+			var follows []events.FollowData
+			for _, id := range followerIds {
+				followerId, _ := id.(int64)
+				follows = append(follows, events.FollowData{FollowerID: int(followerId), FollowedID: userId})
+			}
+			for _, id := range followedIds {
+				followedId, _ := id.(int64)
+				follows = append(follows, events.FollowData{FollowerID: userId, FollowedID: int(followedId)})
+			}
+			for _, follow := range follows {
+				if err := writeHistoryEntry(ctx, transaction, model.ActionUnfollow, follow.FollowerID, follow.FollowedID); err != nil {
+					return nil, err
+				}
+				if err := writeOutboxEvent(ctx, transaction, events.Unfollowed, follow); err != nil {
+					return nil, err
+				}
+			}
+			if err := writeOutboxEvent(ctx, transaction, events.UserDeleted, events.UserData{Id: userId}); err != nil {
+				return nil, err
+			}
+			return int64(len(follows)), nil
+		})
+	if err != nil {
+		ur.logger.Println("Error deleting User:", err)
+		return 0, err
+	}
+	if removedEdges == nil {
+		return 0, ErrUserNotFound
+	}
+	return removedEdges.(int64), nil
+}
+
+func (fr *FollowRepo) GetUserFollowing(ctx context.Context, userId int, options ListOptions) ([]model.Follow, error) {
+	ctx = withUserIDs(ctx, userId)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	following, err := session.ExecuteRead(ctx,
+	following, err := fr.executeRead(ctx, session, "GetUserFollowing",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (u:User {Id: $userId})-[:FOLLOWS]->(f:User)
-                RETURN u.Id, f.Id`,
-				map[string]interface{}{"userId": userId})
+				WHERE $query = '' OR f.Username STARTS WITH $query
+				RETURN u.Id, f.Id
+				ORDER BY f.Id SKIP $skip LIMIT $limit`,
+				options.params(userId))
 			if err != nil {
 				return nil, err
 			}
@@ -192,11 +559,17 @@ func (fr *FollowRepo) GetUserFollowing(userId int) ([]model.Follow, error) {
 			var follows []model.Follow
 			for result.Next(ctx) {
 				record := result.Record()
-				followerID := int(record.Values[0].(int64))
-				followedID := int(record.Values[1].(int64))
+				followerID, err := recordInt64(record, 0)
+				if err != nil {
+					return nil, err
+				}
+				followedID, err := recordInt64(record, 1)
+				if err != nil {
+					return nil, err
+				}
 				follow := model.Follow{
-					FollowerID: followerID,
-					FollowedID: followedID,
+					FollowerID: int(followerID),
+					FollowedID: int(followedID),
 				}
 				follows = append(follows, follow)
 			}
@@ -215,12 +588,215 @@ func (fr *FollowRepo) GetUserFollowing(userId int) ([]model.Follow, error) {
 	return nil, nil
 }
 
-func (fr *FollowRepo) GetUserFollowingIds(userId int) ([]int64, error) {
-	ctx := context.Background()
+// GetUserFollowingUsers returns the profiles of everyone the user follows.
+func (fr *FollowRepo) GetUserFollowingUsers(ctx context.Context, userId int, options ListOptions) ([]model.User, error) {
+	ctx = withUserIDs(ctx, userId)
+	return fr.getNeighbourUsers(ctx, "GetUserFollowingUsers", options.params(userId),
+		`MATCH (u:User {Id: $userId})-[:FOLLOWS]->(f:User)
+		WHERE $query = '' OR f.Username STARTS WITH $query
+		RETURN f
+		ORDER BY f.Id SKIP $skip LIMIT $limit`)
+}
+
+// GetUserFollowerUsers returns the profiles of everyone following the user.
+func (fr *FollowRepo) GetUserFollowerUsers(ctx context.Context, userId int, options ListOptions) ([]model.User, error) {
+	ctx = withUserIDs(ctx, userId)
+	return fr.getNeighbourUsers(ctx, "GetUserFollowerUsers", options.params(userId),
+		`MATCH (u:User {Id: $userId})<-[:FOLLOWS]-(f:User)
+		WHERE $query = '' OR f.Username STARTS WITH $query
+		RETURN f
+		ORDER BY f.Id SKIP $skip LIMIT $limit`)
+}
+
+// StreamAudience calls emit for every follower of each author. Records are
+// handed to emit as they arrive from the server, so the whole audience is
+// never held in memory.
+// An auto-commit query is used because a retried transaction would emit the
+// same followers twice.
+func (fr *FollowRepo) StreamAudience(ctx context.Context, authorIds []int, emit func(authorId int, followerId int) error) error {
+	span, ctx := startSpan(withUserIDs(ctx, authorIds...), "StreamAudience")
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j", AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	start := time.Now()
+	var queryErr error
+	defer func() {
+		metrics.ObserveQuery("StreamAudience", start, queryErr)
+		finishSpan(span, queryErr)
+	}()
+
+	result, err := session.Run(ctx,
+		`UNWIND $authorIds AS authorId
+		MATCH (a:User {Id: authorId})<-[:FOLLOWS]-(f:User)
+		RETURN a.Id, f.Id`,
+		map[string]interface{}{"authorIds": authorIds})
+	if err != nil {
+		fr.logger.Println("Error streaming audience:", err)
+		queryErr = err
+		return err
+	}
+
+	for result.Next(ctx) {
+		record := result.Record()
+		authorId, _ := record.Values[0].(int64)
+		followerId, _ := record.Values[1].(int64)
+		if err := emit(int(authorId), int(followerId)); err != nil {
+			return err
+		}
+	}
+	if err := result.Err(); err != nil {
+		fr.logger.Println("Error streaming audience:", err)
+		queryErr = err
+		return err
+	}
+	return nil
+}
+
+// GetCommonFollowing returns the users followed by both userId and otherId.
+func (fr *FollowRepo) GetCommonFollowing(ctx context.Context, userId int, otherId int, options ListOptions) ([]model.User, error) {
+	ctx = withUserIDs(ctx, userId, otherId)
+	params := options.params(userId)
+	params["otherId"] = otherId
+	return fr.getNeighbourUsers(ctx, "GetCommonFollowing", params,
+		`MATCH (u:User {Id: $userId})-[:FOLLOWS]->(f:User)<-[:FOLLOWS]-(:User {Id: $otherId})
+		WHERE $query = '' OR f.Username STARTS WITH $query
+		RETURN f
+		ORDER BY f.Id SKIP $skip LIMIT $limit`)
+}
+
+// GetFollowersNotFollowing returns the followers of userId who do not follow
+// otherId.
+func (fr *FollowRepo) GetFollowersNotFollowing(ctx context.Context, userId int, otherId int, options ListOptions) ([]model.User, error) {
+	ctx = withUserIDs(ctx, userId, otherId)
+	params := options.params(userId)
+	params["otherId"] = otherId
+	return fr.getNeighbourUsers(ctx, "GetFollowersNotFollowing", params,
+		`MATCH (u:User {Id: $userId})<-[:FOLLOWS]-(f:User)
+		WHERE f.Id <> $otherId
+			AND NOT (f)-[:FOLLOWS]->(:User {Id: $otherId})
+			AND ($query = '' OR f.Username STARTS WITH $query)
+		RETURN f
+		ORDER BY f.Id SKIP $skip LIMIT $limit`)
+}
+
+// GetFollowersYouKnow returns the followers of userId that viewerId follows,
+// which backs the "followed by people you know" badge on profiles.
+func (fr *FollowRepo) GetFollowersYouKnow(ctx context.Context, userId int, viewerId int, options ListOptions) ([]model.User, error) {
+	ctx = withUserIDs(ctx, userId, viewerId)
+	params := options.params(userId)
+	params["viewerId"] = viewerId
+	return fr.getNeighbourUsers(ctx, "GetFollowersYouKnow", params,
+		`MATCH (:User {Id: $viewerId})-[:FOLLOWS]->(f:User)-[:FOLLOWS]->(u:User {Id: $userId})
+		WHERE $query = '' OR f.Username STARTS WITH $query
+		RETURN f
+		ORDER BY f.Id SKIP $skip LIMIT $limit`)
+}
+
+func (fr *FollowRepo) getNeighbourUsers(ctx context.Context, method string, params map[string]interface{}, query string) ([]model.User, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	users, err := fr.executeRead(ctx, session, method,
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx, query, params)
+			if err != nil {
+				return nil, err
+			}
+
+			var userList []model.User
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				userList = append(userList, userFromNode(node))
+			}
+
+			return userList, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting users:", err)
+		return nil, err
+	}
+
+	return users.([]model.User), nil
+}
+
+// SearchUsers finds users whose username starts with prefix. People the
+// caller already follows are ranked first, followed by second-degree
+// connections and then everybody else.
+func (fr *FollowRepo) SearchUsers(ctx context.Context, prefix string, callerId int, limit int) ([]model.User, error) {
+	ctx = withUserIDs(ctx, callerId)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	users, err := fr.executeRead(ctx, session, "SearchUsers",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (u:User)
+				WHERE u.Username STARTS WITH $prefix AND u.Id <> $callerId
+				OPTIONAL MATCH (caller:User {Id: $callerId})
+				WITH u, CASE
+					WHEN caller IS NULL THEN 2
+					WHEN EXISTS { MATCH (caller)-[:FOLLOWS]->(u) } THEN 0
+					WHEN EXISTS { MATCH (caller)-[:FOLLOWS]->(:User)-[:FOLLOWS]->(u) } THEN 1
+					ELSE 2
+				END AS rank
+				RETURN u
+				ORDER BY rank, u.Username
+				LIMIT $limit`,
+				map[string]interface{}{"prefix": prefix, "callerId": callerId, "limit": limit})
+			if err != nil {
+				return nil, err
+			}
+
+			var userList []model.User
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				userList = append(userList, userFromNode(node))
+			}
+
+			return userList, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error searching users:", err)
+		return nil, err
+	}
+
+	return users.([]model.User), nil
+}
+
+func userData(user *model.User) events.UserData {
+	return events.UserData{
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarUrl:   user.AvatarUrl,
+		Role:        user.Role,
+	}
+}
+
+func userFromNode(node neo4j.Node) model.User {
+	user := model.User{}
+	if id, ok := node.Props["Id"].(int64); ok {
+		user.Id = int(id)
+	}
+	user.Username, _ = node.Props["Username"].(string)
+	user.DisplayName, _ = node.Props["DisplayName"].(string)
+	user.AvatarUrl, _ = node.Props["AvatarUrl"].(string)
+	user.Role, _ = node.Props["Role"].(string)
+	return user
+}
+
+func (fr *FollowRepo) GetUserFollowingIds(ctx context.Context, userId int) ([]int64, error) {
+	ctx = withUserIDs(ctx, userId)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	following, err := session.ExecuteRead(ctx,
+	following, err := fr.executeRead(ctx, session, "GetUserFollowingIds",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (u:User {Id: $userId})-[:FOLLOWS]->(f:User)
@@ -233,9 +809,15 @@ func (fr *FollowRepo) GetUserFollowingIds(userId int) ([]int64, error) {
 			var followedIds []int64
 			for result.Next(ctx) {
 				record := result.Record()
-				followedIDs := record.Values[0].([]interface{})
+				followedIDs, err := recordValue[[]interface{}](record, 0)
+				if err != nil {
+					return nil, err
+				}
 				for _, id := range followedIDs {
-					followedId := id.(int64)
+					followedId, ok := id.(int64)
+					if !ok {
+						return nil, fmt.Errorf("unexpected %T in followed IDs", id)
+					}
 					followedIds = append(followedIds, followedId)
 				}
 			}
@@ -255,17 +837,19 @@ func (fr *FollowRepo) GetUserFollowingIds(userId int) ([]int64, error) {
 	return nil, nil
 }
 
-func (fr *FollowRepo) GetUserFollowers(userId int) ([]model.Follow, error) {
-	ctx := context.Background()
+func (fr *FollowRepo) GetUserFollowers(ctx context.Context, userId int, options ListOptions) ([]model.Follow, error) {
+	ctx = withUserIDs(ctx, userId)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	followers, err := session.ExecuteRead(ctx,
+	followers, err := fr.executeRead(ctx, session, "GetUserFollowers",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (u:User {Id: $userId})<-[:FOLLOWS]-(f:User)
-                RETURN f.Id, u.Id`,
-				map[string]interface{}{"userId": userId})
+				WHERE $query = '' OR f.Username STARTS WITH $query
+				RETURN f.Id, u.Id
+				ORDER BY f.Id SKIP $skip LIMIT $limit`,
+				options.params(userId))
 			if err != nil {
 				return nil, err
 			}
@@ -273,11 +857,17 @@ func (fr *FollowRepo) GetUserFollowers(userId int) ([]model.Follow, error) {
 			var followerList []model.Follow
 			for result.Next(ctx) {
 				record := result.Record()
-				followerID := int(record.Values[0].(int64))
-				followedID := int(record.Values[1].(int64))
+				followerID, err := recordInt64(record, 0)
+				if err != nil {
+					return nil, err
+				}
+				followedID, err := recordInt64(record, 1)
+				if err != nil {
+					return nil, err
+				}
 				follower := model.Follow{
-					FollowerID: followerID,
-					FollowedID: followedID,
+					FollowerID: int(followerID),
+					FollowedID: int(followedID),
 				}
 				followerList = append(followerList, follower)
 			}
@@ -296,12 +886,12 @@ func (fr *FollowRepo) GetUserFollowers(userId int) ([]model.Follow, error) {
 	return nil, nil
 }
 
-func (fr *FollowRepo) GetFollowRecommendations(userID int) ([]int64, error) {
-	ctx := context.Background()
+func (fr *FollowRepo) GetFollowRecommendations(ctx context.Context, userID int) ([]int64, error) {
+	ctx = withUserIDs(ctx, userID)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	result, err := session.ExecuteRead(ctx,
+	result, err := fr.executeRead(ctx, session, "GetFollowRecommendations",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (u:User {Id: $userID})-[:FOLLOWS]->(:User)-[:FOLLOWS]->(recommendation:User)
@@ -321,7 +911,9 @@ func (fr *FollowRepo) GetFollowRecommendations(userID int) ([]int64, error) {
 				if !found {
 					continue
 				}
-				recommendations = append(recommendations, recommendationID.(int64))
+				if id, ok := recommendationID.(int64); ok {
+					recommendations = append(recommendations, id)
+				}
 			}
 
 			return recommendations, nil
@@ -334,7 +926,7 @@ func (fr *FollowRepo) GetFollowRecommendations(userID int) ([]int64, error) {
 
 	if recommendations, ok := result.([]int64); ok {
 		if len(recommendations) < 10 {
-			additionalRecommendations, err := fr.getAdditionalRecommendations(ctx, session, userID, len(recommendations), 10)
+			additionalRecommendations, err := fr.getAdditionalRecommendations(ctx, "GetFollowRecommendations", session, userID, len(recommendations), 10)
 			if err != nil {
 				fr.logger.Println("Error getting additional follow recommendations:", err)
 				return nil, err
@@ -360,8 +952,8 @@ func (fr *FollowRepo) GetFollowRecommendations(userID int) ([]int64, error) {
 	return nil, nil
 }
 
-func (fr *FollowRepo) getAdditionalRecommendations(ctx context.Context, session neo4j.SessionWithContext, userID, currentCount, targetCount int) ([]int64, error) {
-	result, err := session.ExecuteRead(ctx,
+func (fr *FollowRepo) getAdditionalRecommendations(ctx context.Context, method string, session neo4j.SessionWithContext, userID, currentCount, targetCount int) ([]int64, error) {
+	result, err := fr.executeRead(ctx, session, method,
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := transaction.Run(ctx,
 				`MATCH (u:User {Id: $userID})
@@ -382,7 +974,9 @@ func (fr *FollowRepo) getAdditionalRecommendations(ctx context.Context, session
 				if !found {
 					continue
 				}
-				additionalRecommendations = append(additionalRecommendations, recommendationID.(int64))
+				if id, ok := recommendationID.(int64); ok {
+					additionalRecommendations = append(additionalRecommendations, id)
+				}
 			}
 
 			return additionalRecommendations, nil
@@ -399,20 +993,32 @@ func (fr *FollowRepo) getAdditionalRecommendations(ctx context.Context, session
 	return nil, nil
 }
 
-func (fr *FollowRepo) UnfollowUser(follow model.Follow) error {
-	ctx := context.Background()
+func (fr *FollowRepo) UnfollowUser(ctx context.Context, follow model.Follow) error {
+	ctx = withUserIDs(ctx, follow.FollowerID, follow.FollowedID)
 	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
 	defer session.Close(ctx)
 
-	_, err := session.ExecuteWrite(ctx,
+	_, err := fr.executeWrite(ctx, session, "UnfollowUser",
 		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
-			_, err := transaction.Run(ctx,
+			result, err := transaction.Run(ctx,
 				`MATCH (follower:User {Id: $followerID})-[r:FOLLOWS]->(followed:User {Id: $followedID})
-				DELETE r`,
+				DELETE r
+				RETURN count(r)`,
 				map[string]interface{}{"followerID": follow.FollowerID, "followedID": follow.FollowedID})
 			if err != nil {
 				return nil, err
 			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if deleted, _ := record.Values[0].(int64); deleted > 0 {
+				if err := writeHistoryEntry(ctx, transaction, model.ActionUnfollow, follow.FollowerID, follow.FollowedID); err != nil {
+					return nil, err
+				}
+				return nil, writeOutboxEvent(ctx, transaction, events.Unfollowed,
+					events.FollowData{FollowerID: follow.FollowerID, FollowedID: follow.FollowedID})
+			}
 			return nil, nil
 		})
 
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"followers-service.xws.com/auth"
+	"followers-service.xws.com/model"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// writeHistoryEntry appends to the follow history in the same transaction as
+// the change it records. History nodes are never updated or deleted, and are
+// not attached to the users so they outlive them. The actor is the caller in
+// ctx, a user or a service API key, which differs from the follower when an
+// admin acts for them; without a caller the follower is recorded.
+func writeHistoryEntry(ctx context.Context, transaction neo4j.ManagedTransaction, action string, followerId int, followedId int) error {
+	var actorId, actorKeyId interface{} = followerId, nil
+	if caller, ok := auth.CallerFrom(ctx); ok {
+		if caller.KeyID != "" {
+			actorId, actorKeyId = nil, caller.KeyID
+		} else {
+			actorId = caller.UserID
+		}
+	}
+	_, err := transaction.Run(ctx,
+		`CREATE (h:FollowHistory)
+		SET h.Action = $action, h.ActorId = $actorId, h.ActorKeyId = $actorKeyId,
+			h.FollowerId = $followerId, h.FollowedId = $followedId, h.At = datetime()`,
+		map[string]interface{}{"action": action, "actorId": actorId, "actorKeyId": actorKeyId,
+			"followerId": followerId, "followedId": followedId})
+	return err
+}
+
+// GetUserHistory returns the history entries in which the user is either the
+// follower or the followed, newest first, limited to [from, to).
+func (fr *FollowRepo) GetUserHistory(ctx context.Context, userId int, from time.Time, to time.Time, options ListOptions) ([]model.HistoryEntry, error) {
+	ctx = withUserIDs(ctx, userId)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	params := options.params(userId)
+	params["from"] = from
+	params["to"] = to
+
+	history, err := fr.executeRead(ctx, session, "GetUserHistory",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`CALL {
+					MATCH (h:FollowHistory) WHERE h.FollowerId = $userId RETURN h
+					UNION
+					MATCH (h:FollowHistory) WHERE h.FollowedId = $userId RETURN h
+				}
+				WITH h
+				WHERE h.At >= $from AND h.At < $to
+				RETURN h
+				ORDER BY h.At DESC SKIP $skip LIMIT $limit`,
+				params)
+			if err != nil {
+				return nil, err
+			}
+
+			entries := []model.HistoryEntry{}
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, historyEntryFromNode(node))
+			}
+			return entries, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting history:", err)
+		return nil, err
+	}
+	return history.([]model.HistoryEntry), nil
+}
+
+func historyEntryFromNode(node neo4j.Node) model.HistoryEntry {
+	entry := model.HistoryEntry{}
+	entry.Action, _ = node.Props["Action"].(string)
+	if actorId, ok := node.Props["ActorId"].(int64); ok {
+		entry.ActorID = int(actorId)
+	}
+	entry.ActorKeyID, _ = node.Props["ActorKeyId"].(string)
+	if followerId, ok := node.Props["FollowerId"].(int64); ok {
+		entry.FollowerID = int(followerId)
+	}
+	if followedId, ok := node.Props["FollowedId"].(int64); ok {
+		entry.FollowedID = int(followedId)
+	}
+	entry.At, _ = node.Props["At"].(time.Time)
+	return entry
+}
@@ -0,0 +1,233 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/tracing"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// PendingEvent is an outbox entry that still has to be handed to the
+// publisher, together with the number of failed attempts so far, the
+// publishers an earlier attempt already reached and the traceparent of the
+// change that wrote it.
+type PendingEvent struct {
+	Event       events.Event
+	Attempts    int
+	PublishedTo []string
+	Traceparent string
+}
+
+// OutboxLag describes how far the relay is behind the writes.
+type OutboxLag struct {
+	Pending          int64
+	OldestOccurredAt time.Time
+	Dead             int64
+}
+
+// writeOutboxEvent stores the event in the same transaction as the change it
+// describes, so that either both are committed or neither is. The trace of
+// the change is kept with it for the relay to continue.
+func writeOutboxEvent(ctx context.Context, transaction neo4j.ManagedTransaction, eventType string, data interface{}) error {
+	event, err := events.New(eventType, data)
+	if err != nil {
+		return err
+	}
+	var traceparent interface{}
+	if value := tracing.Traceparent(ctx); value != "" {
+		traceparent = value
+	}
+	_, err = transaction.Run(ctx,
+		`CREATE (e:OutboxEvent)
+		SET e.Id = $id, e.Type = $type, e.Version = $version, e.OccurredAt = $occurredAt,
+			e.Data = $data, e.Attempts = 0, e.NextAttemptAt = $occurredAt, e.Traceparent = $traceparent`,
+		map[string]interface{}{"id": event.Id, "type": event.Type, "version": event.Version,
+			"occurredAt": event.OccurredAt, "data": string(event.Data), "traceparent": traceparent})
+	return err
+}
+
+// ClaimPendingEvents leases up to limit undelivered events that are due for a
+// delivery attempt to owner for leaseFor, oldest first. Events leased to
+// another relay are skipped until their lease runs out, so replicas do not
+// publish the same events side by side.
+func (fr *FollowRepo) ClaimPendingEvents(ctx context.Context, owner string, limit int, leaseFor time.Duration) ([]PendingEvent, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	pending, err := fr.executeWrite(ctx, session, "ClaimPendingEvents",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			// Setting _LOCK_ takes the write lock on each candidate, after
+			// which the lease is checked again: a relay that claimed the
+			// event while we waited for the lock has committed by then.
+			result, err := transaction.Run(ctx,
+				`MATCH (e:OutboxEvent)
+				WHERE e.DeliveredAt IS NULL AND e.DeadAt IS NULL AND e.NextAttemptAt <= datetime()
+					AND (e.LeaseUntil IS NULL OR e.LeaseUntil <= datetime())
+				WITH e
+				ORDER BY e.OccurredAt
+				LIMIT $limit
+				SET e._LOCK_ = true
+				WITH e, e.DeliveredAt IS NULL AND (e.LeaseUntil IS NULL OR e.LeaseUntil <= datetime()) AS free
+				REMOVE e._LOCK_
+				WITH e
+				WHERE free
+				SET e.LeaseOwner = $owner, e.LeaseUntil = datetime() + duration({milliseconds: $leaseMillis})
+				RETURN e
+				ORDER BY e.OccurredAt`,
+				map[string]interface{}{"limit": limit, "owner": owner, "leaseMillis": leaseFor.Milliseconds()})
+			if err != nil {
+				return nil, err
+			}
+
+			var pendingEvents []PendingEvent
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				event := events.Event{}
+				event.Id, _ = node.Props["Id"].(string)
+				event.Type, _ = node.Props["Type"].(string)
+				if version, ok := node.Props["Version"].(int64); ok {
+					event.Version = int(version)
+				}
+				event.OccurredAt, _ = node.Props["OccurredAt"].(time.Time)
+				if data, ok := node.Props["Data"].(string); ok {
+					event.Data = []byte(data)
+				}
+				attempts, _ := node.Props["Attempts"].(int64)
+				p := PendingEvent{Event: event, Attempts: int(attempts)}
+				p.Traceparent, _ = node.Props["Traceparent"].(string)
+				if publishedTo, ok := node.Props["PublishedTo"].([]interface{}); ok {
+					for _, name := range publishedTo {
+						if value, ok := name.(string); ok {
+							p.PublishedTo = append(p.PublishedTo, value)
+						}
+					}
+				}
+				pendingEvents = append(pendingEvents, p)
+			}
+
+			return pendingEvents, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error claiming pending events:", err)
+		return nil, err
+	}
+
+	return pending.([]PendingEvent), nil
+}
+
+// MarkEventDelivered records that every publisher has the event and releases
+// its lease.
+func (fr *FollowRepo) MarkEventDelivered(ctx context.Context, eventId string) error {
+	return fr.updateOutboxEvent(ctx, "MarkEventDelivered", eventId,
+		`MATCH (e:OutboxEvent {Id: $id})
+		SET e.DeliveredAt = datetime()
+		REMOVE e.LeaseOwner, e.LeaseUntil`,
+		nil)
+}
+
+// MarkEventFailed records a failed delivery attempt, the publishers that did
+// receive the event and the error, and postpones the next attempt until
+// nextAttemptAt.
+func (fr *FollowRepo) MarkEventFailed(ctx context.Context, eventId string, publishedTo []string, lastError string, nextAttemptAt time.Time) error {
+	return fr.updateOutboxEvent(ctx, "MarkEventFailed", eventId,
+		`MATCH (e:OutboxEvent {Id: $id})
+		SET e.Attempts = e.Attempts + 1, e.NextAttemptAt = $nextAttemptAt,
+			e.PublishedTo = $publishedTo, e.LastError = $lastError
+		REMOVE e.LeaseOwner, e.LeaseUntil`,
+		map[string]interface{}{"nextAttemptAt": nextAttemptAt, "publishedTo": publishedTo, "lastError": lastError})
+}
+
+// MarkEventDead records the last failed delivery attempt of an event that is
+// not retried any more. Dead events stay in the outbox with their last error
+// until they are looked into.
+func (fr *FollowRepo) MarkEventDead(ctx context.Context, eventId string, publishedTo []string, lastError string) error {
+	return fr.updateOutboxEvent(ctx, "MarkEventDead", eventId,
+		`MATCH (e:OutboxEvent {Id: $id})
+		SET e.Attempts = e.Attempts + 1, e.DeadAt = datetime(),
+			e.PublishedTo = $publishedTo, e.LastError = $lastError
+		REMOVE e.LeaseOwner, e.LeaseUntil`,
+		map[string]interface{}{"publishedTo": publishedTo, "lastError": lastError})
+}
+
+// PruneDeliveredEvents deletes events that were delivered before the given
+// time, keeping the outbox from growing without bound.
+func (fr *FollowRepo) PruneDeliveredEvents(ctx context.Context, before time.Time) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	_, err := fr.executeWrite(ctx, session, "PruneDeliveredEvents",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := transaction.Run(ctx,
+				`MATCH (e:OutboxEvent)
+				WHERE e.DeliveredAt < $before
+				DELETE e`,
+				map[string]interface{}{"before": before})
+			return nil, err
+		})
+	if err != nil {
+		fr.logger.Println("Error pruning delivered events:", err)
+		return err
+	}
+	return nil
+}
+
+// GetOutboxLag counts the events still to be delivered and the dead ones.
+func (fr *FollowRepo) GetOutboxLag(ctx context.Context) (OutboxLag, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	lag, err := fr.executeRead(ctx, session, "GetOutboxLag",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (e:OutboxEvent)
+				WHERE e.DeliveredAt IS NULL
+				RETURN count(CASE WHEN e.DeadAt IS NULL THEN e END),
+					min(CASE WHEN e.DeadAt IS NULL THEN e.OccurredAt END),
+					count(e.DeadAt)`,
+				nil)
+			if err != nil {
+				return nil, err
+			}
+
+			lag := OutboxLag{}
+			if result.Next(ctx) {
+				record := result.Record()
+				lag.Pending, _ = record.Values[0].(int64)
+				lag.OldestOccurredAt, _ = record.Values[1].(time.Time)
+				lag.Dead, _ = record.Values[2].(int64)
+			}
+			return lag, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting outbox lag:", err)
+		return OutboxLag{}, err
+	}
+
+	return lag.(OutboxLag), nil
+}
+
+func (fr *FollowRepo) updateOutboxEvent(ctx context.Context, method string, eventId string, query string, params map[string]interface{}) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	params["id"] = eventId
+
+	_, err := fr.executeWrite(ctx, session, method,
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := transaction.Run(ctx, query, params)
+			return nil, err
+		})
+	if err != nil {
+		fr.logger.Println("Error updating outbox event:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// recordNode returns column index of record as a node, reporting an error
+// instead of panicking when the query returned something else.
+func recordNode(record *neo4j.Record, index int) (neo4j.Node, error) {
+	return recordValue[neo4j.Node](record, index)
+}
+
+func recordInt64(record *neo4j.Record, index int) (int64, error) {
+	return recordValue[int64](record, index)
+}
+
+func recordValue[T any](record *neo4j.Record, index int) (T, error) {
+	var zero T
+	if index >= len(record.Values) {
+		return zero, fmt.Errorf("record has no column %d", index)
+	}
+	value, ok := record.Values[index].(T)
+	if !ok {
+		return zero, fmt.Errorf("unexpected %T in column %d, expected %T", record.Values[index], index, zero)
+	}
+	return value, nil
+}
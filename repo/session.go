@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"followers-service.xws.com/metrics"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// executeRead runs work in a read transaction of session, recording its
+// duration and failure under method, the FollowRepo method it serves. The
+// transaction gets its own span, a child of the request's span in ctx.
+func (fr *FollowRepo) executeRead(ctx context.Context, session neo4j.SessionWithContext, method string, work neo4j.ManagedTransactionWork) (any, error) {
+	span, ctx := startSpan(ctx, method)
+	start := time.Now()
+	result, err := session.ExecuteRead(ctx, work)
+	metrics.ObserveQuery(method, start, failure(err))
+	finishSpan(span, err)
+	return result, err
+}
+
+// executeWrite is executeRead for write transactions.
+func (fr *FollowRepo) executeWrite(ctx context.Context, session neo4j.SessionWithContext, method string, work neo4j.ManagedTransactionWork) (any, error) {
+	span, ctx := startSpan(ctx, method)
+	start := time.Now()
+	result, err := session.ExecuteWrite(ctx, work)
+	metrics.ObserveQuery(method, start, failure(err))
+	finishSpan(span, err)
+	return result, err
+}
+
+type keyUserIDs struct{}
+
+// withUserIDs records the users a FollowRepo call is about, so the spans of
+// its transactions can be found by user.
+func withUserIDs(ctx context.Context, ids ...int) context.Context {
+	return context.WithValue(ctx, keyUserIDs{}, ids)
+}
+
+func startSpan(ctx context.Context, method string) (opentracing.Span, context.Context) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "neo4j "+method)
+	ext.DBType.Set(span, "neo4j")
+	span.SetTag("db.query", method)
+	if ids, ok := ctx.Value(keyUserIDs{}).([]int); ok && len(ids) > 0 {
+		values := make([]string, len(ids))
+		for i, id := range ids {
+			values[i] = strconv.Itoa(id)
+		}
+		span.SetTag("user.ids", strings.Join(values, ","))
+	}
+	return span, ctx
+}
+
+// finishSpan marks the span failed unless err is one of the sentinel
+// outcomes.
+func finishSpan(span opentracing.Span, err error) {
+	if err := failure(err); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+	}
+	span.Finish()
+}
+
+// failure drops the sentinel errors returned from inside transactions, which
+// report an outcome such as a missing user rather than a failed query.
+func failure(err error) error {
+	for _, sentinel := range []error{ErrUserNotFound, ErrAlreadyFollowing, ErrSelfFollow,
+		ErrFollowingLimit, ErrWebhookNotFound, ErrNotFlagged} {
+		if errors.Is(err, sentinel) {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"followers-service.xws.com/model"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// GetFollowActivity sums the follow history since the given time per user,
+// leaving out users with fewer than minActions follows and unfollows. Only
+// changes users made themselves count, not those an admin or a service made
+// for them.
+// History from before an admin last cleared a user's flag is not counted, so
+// a cleared user is not flagged again for the same activity.
+func (fr *FollowRepo) GetFollowActivity(ctx context.Context, since time.Time, minActions int) ([]model.FollowActivity, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	activity, err := fr.executeRead(ctx, session, "GetFollowActivity",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (h:FollowHistory)
+				WHERE h.At >= $since AND h.ActorKeyId IS NULL AND h.ActorId = h.FollowerId
+				OPTIONAL MATCH (s:SuspiciousFlag {UserId: h.FollowerId})
+				WITH h, s
+				WHERE s.ClearedAt IS NULL OR h.At >= s.ClearedAt
+				WITH h.FollowerId AS userId, h.FollowedId AS target,
+					sum(CASE WHEN h.Action = $follow THEN 1 ELSE 0 END) AS follows,
+					sum(CASE WHEN h.Action = $unfollow THEN 1 ELSE 0 END) AS unfollows
+				WITH userId, sum(follows) AS follows, sum(unfollows) AS unfollows,
+					sum(CASE WHEN follows > 0 AND unfollows > 0 THEN 1 ELSE 0 END) AS churned
+				WHERE follows + unfollows >= $minActions
+				RETURN userId, follows, unfollows, churned`,
+				map[string]interface{}{"since": since, "minActions": minActions,
+					"follow": model.ActionFollow, "unfollow": model.ActionUnfollow})
+			if err != nil {
+				return nil, err
+			}
+
+			activity := []model.FollowActivity{}
+			for result.Next(ctx) {
+				record := result.Record()
+				userId, _ := record.Values[0].(int64)
+				follows, _ := record.Values[1].(int64)
+				unfollows, _ := record.Values[2].(int64)
+				churned, _ := record.Values[3].(int64)
+				activity = append(activity, model.FollowActivity{
+					UserID: int(userId), Follows: int(follows), Unfollows: int(unfollows), Churned: int(churned)})
+			}
+			return activity, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting follow activity:", err)
+		return nil, err
+	}
+	return activity.([]model.FollowActivity), nil
+}
+
+// FlagSuspiciousUser records why a user was flagged and shadow-limits their
+// follows until limitedUntil. Flagging a user whose limit is still in force
+// only updates the reason and counts; once the limit has run out the flag is
+// raised again.
+func (fr *FollowRepo) FlagSuspiciousUser(ctx context.Context, activity model.FollowActivity, reason string, limitedUntil time.Time) error {
+	ctx = withUserIDs(ctx, activity.UserID)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	_, err := fr.executeWrite(ctx, session, "FlagSuspiciousUser",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`OPTIONAL MATCH (s:SuspiciousFlag {UserId: $userId})
+				RETURN s.FlaggedAt, s.LimitedUntil`,
+				map[string]interface{}{"userId": activity.UserID})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			flaggedAt, _ := record.Values[0].(time.Time)
+			currentLimit, _ := record.Values[1].(time.Time)
+			flaggedAt, limitedUntil := flagPeriod(flaggedAt, currentLimit, time.Now().UTC(), limitedUntil)
+
+			_, err = transaction.Run(ctx,
+				`MERGE (s:SuspiciousFlag {UserId: $userId})
+				SET s.Reason = $reason, s.Follows = $follows, s.Unfollows = $unfollows, s.Churned = $churned,
+					s.FlaggedAt = $flaggedAt, s.LimitedUntil = $limitedUntil`,
+				map[string]interface{}{"userId": activity.UserID, "reason": reason, "follows": activity.Follows,
+					"unfollows": activity.Unfollows, "churned": activity.Churned, "flaggedAt": flaggedAt,
+					"limitedUntil": limitedUntil})
+			return nil, err
+		})
+	if err != nil {
+		fr.logger.Println("Error flagging user:", err)
+		return err
+	}
+	return nil
+}
+
+// flagPeriod returns when a flag raised at now started and until when it
+// limits follows. A flag whose limit is still in force keeps both; a new
+// flag, or one whose limit has run out or was cleared, starts at now and
+// lasts until limitedUntil.
+func flagPeriod(flaggedAt time.Time, currentLimit time.Time, now time.Time, limitedUntil time.Time) (time.Time, time.Time) {
+	if !flaggedAt.IsZero() && currentLimit.After(now) {
+		return flaggedAt, currentLimit
+	}
+	return now, limitedUntil
+}
+
+// GetSuspiciousUsers lists flagged users, most recently flagged first.
+// Cleared flags are left out.
+func (fr *FollowRepo) GetSuspiciousUsers(ctx context.Context, options ListOptions) ([]model.SuspiciousUser, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	users, err := fr.executeRead(ctx, session, "GetSuspiciousUsers",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (s:SuspiciousFlag)
+				WHERE s.FlaggedAt IS NOT NULL
+				OPTIONAL MATCH (u:User {Id: s.UserId})
+				RETURN s, u.Username
+				ORDER BY s.FlaggedAt DESC SKIP $skip LIMIT $limit`,
+				options.params(0))
+			if err != nil {
+				return nil, err
+			}
+
+			users := []model.SuspiciousUser{}
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				user := suspiciousUserFromNode(node)
+				user.Username, _ = result.Record().Values[1].(string)
+				users = append(users, user)
+			}
+			return users, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting suspicious users:", err)
+		return nil, err
+	}
+	return users.([]model.SuspiciousUser), nil
+}
+
+// ClearSuspiciousUser clears the flag of a user, lifting the limit on their
+// follows. The flag node keeps when it was cleared, so GetFollowActivity
+// only holds later activity against the user.
+func (fr *FollowRepo) ClearSuspiciousUser(ctx context.Context, userId int) error {
+	ctx = withUserIDs(ctx, userId)
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	cleared, err := fr.executeWrite(ctx, session, "ClearSuspiciousUser",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (s:SuspiciousFlag {UserId: $userId})
+				WHERE s.FlaggedAt IS NOT NULL
+				SET s.ClearedAt = datetime()
+				REMOVE s.FlaggedAt, s.LimitedUntil, s.Reason
+				RETURN count(s)`,
+				map[string]interface{}{"userId": userId})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return recordInt64(record, 0)
+		})
+	if err != nil {
+		fr.logger.Println("Error clearing suspicious user:", err)
+		return err
+	}
+	if cleared, _ := cleared.(int64); cleared == 0 {
+		return ErrNotFlagged
+	}
+	return nil
+}
+
+func suspiciousUserFromNode(node neo4j.Node) model.SuspiciousUser {
+	user := model.SuspiciousUser{}
+	if userId, ok := node.Props["UserId"].(int64); ok {
+		user.UserID = int(userId)
+	}
+	if follows, ok := node.Props["Follows"].(int64); ok {
+		user.Follows = int(follows)
+	}
+	if unfollows, ok := node.Props["Unfollows"].(int64); ok {
+		user.Unfollows = int(unfollows)
+	}
+	if churned, ok := node.Props["Churned"].(int64); ok {
+		user.Churned = int(churned)
+	}
+	user.Reason, _ = node.Props["Reason"].(string)
+	user.FlaggedAt, _ = node.Props["FlaggedAt"].(time.Time)
+	user.LimitedUntil, _ = node.Props["LimitedUntil"].(time.Time)
+	return user
+}
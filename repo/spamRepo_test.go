@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlagPeriod(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 3, 1, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name                     string
+		flaggedAt, currentLimit  time.Time
+		now, limitedUntil        time.Time
+		wantFlaggedAt, wantLimit time.Time
+	}{
+		{
+			name: "first flag",
+			now:  at(2), limitedUntil: at(10),
+			wantFlaggedAt: at(2), wantLimit: at(10),
+		},
+		{
+			name:      "limit still in force",
+			flaggedAt: at(1), currentLimit: at(9),
+			now: at(2), limitedUntil: at(10),
+			wantFlaggedAt: at(1), wantLimit: at(9),
+		},
+		{
+			// A second burst after the limit ran out limits the user again
+			name:      "limit expired",
+			flaggedAt: at(1), currentLimit: at(3),
+			now: at(5), limitedUntil: at(13),
+			wantFlaggedAt: at(5), wantLimit: at(13),
+		},
+		{
+			name:      "limit ends now",
+			flaggedAt: at(1), currentLimit: at(5),
+			now: at(5), limitedUntil: at(13),
+			wantFlaggedAt: at(5), wantLimit: at(13),
+		},
+		{
+			// Clearing removes FlaggedAt and LimitedUntil
+			name: "cleared flag",
+			now:  at(5), limitedUntil: at(13),
+			wantFlaggedAt: at(5), wantLimit: at(13),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flaggedAt, limit := flagPeriod(test.flaggedAt, test.currentLimit, test.now, test.limitedUntil)
+			if !flaggedAt.Equal(test.wantFlaggedAt) || !limit.Equal(test.wantLimit) {
+				t.Fatalf("flagPeriod = %v, %v, want %v, %v", flaggedAt, limit, test.wantFlaggedAt, test.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"followers-service.xws.com/model"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func (fr *FollowRepo) AddWebhook(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	saved, err := fr.executeWrite(ctx, session, "AddWebhook",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`CREATE (w:Webhook)
+				SET w.Id = randomUUID(), w.Url = $url, w.EventTypes = $eventTypes, w.Secret = $secret,
+					w.Active = true, w.ConsecutiveFailures = 0, w.CreatedAt = datetime()
+				RETURN w`,
+				map[string]interface{}{"url": webhook.Url, "eventTypes": webhook.EventTypes, "secret": webhook.Secret})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			node, err := recordNode(record, 0)
+			if err != nil {
+				return nil, err
+			}
+			saved := webhookFromNode(node)
+			return &saved, nil
+		})
+	if err != nil {
+		fr.logger.Println("Error inserting webhook:", err)
+		return nil, err
+	}
+	return saved.(*model.Webhook), nil
+}
+
+// GetWebhooks lists every registered webhook. Secrets are not returned.
+func (fr *FollowRepo) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	webhooks, err := fr.queryWebhooks(ctx, "GetWebhooks",
+		`MATCH (w:Webhook)
+		RETURN w
+		ORDER BY w.CreatedAt`,
+		nil)
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, err
+}
+
+// GetActiveWebhooksForEvent returns the enabled webhooks subscribed to the
+// event type, including their signing secrets.
+func (fr *FollowRepo) GetActiveWebhooksForEvent(ctx context.Context, eventType string) ([]model.Webhook, error) {
+	return fr.queryWebhooks(ctx, "GetActiveWebhooksForEvent",
+		`MATCH (w:Webhook)
+		WHERE w.Active AND $eventType IN w.EventTypes
+		RETURN w`,
+		map[string]interface{}{"eventType": eventType})
+}
+
+func (fr *FollowRepo) DeleteWebhook(ctx context.Context, webhookId string) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	deleted, err := fr.executeWrite(ctx, session, "DeleteWebhook",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (w:Webhook {Id: $id})
+				OPTIONAL MATCH (w)-[:DELIVERED]->(d:WebhookDelivery)
+				DETACH DELETE w, d
+				RETURN count(DISTINCT w)`,
+				map[string]interface{}{"id": webhookId})
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return recordInt64(record, 0)
+		})
+	if err != nil {
+		fr.logger.Println("Error deleting webhook:", err)
+		return err
+	}
+	if deleted, _ := deleted.(int64); deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// SetWebhookActive enables or disables a webhook. Enabling it also clears its
+// failure count.
+func (fr *FollowRepo) SetWebhookActive(ctx context.Context, webhookId string, active bool) error {
+	return fr.updateWebhook(ctx, "SetWebhookActive", webhookId,
+		`MATCH (w:Webhook {Id: $id})
+		SET w.Active = $active, w.ConsecutiveFailures = CASE WHEN $active THEN 0 ELSE w.ConsecutiveFailures END
+		RETURN count(w)`,
+		map[string]interface{}{"active": active})
+}
+
+// RecordWebhookResult stores the outcome of a delivery attempt. A webhook is
+// disabled once disableAfter attempts in a row have failed.
+func (fr *FollowRepo) RecordWebhookResult(ctx context.Context, webhookId string, success bool, disableAfter int) error {
+	return fr.updateWebhook(ctx, "RecordWebhookResult", webhookId,
+		`MATCH (w:Webhook {Id: $id})
+		SET w.ConsecutiveFailures = CASE WHEN $success THEN 0 ELSE w.ConsecutiveFailures + 1 END
+		SET w.Active = w.Active AND w.ConsecutiveFailures < $disableAfter
+		RETURN count(w)`,
+		map[string]interface{}{"success": success, "disableAfter": disableAfter})
+}
+
+// AddWebhookDelivery logs an attempt at delivering an event to a webhook and
+// numbers it after the attempts already logged for the event.
+func (fr *FollowRepo) AddWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	attempt, err := fr.executeWrite(ctx, session, "AddWebhookDelivery",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (w:Webhook {Id: $webhookId})
+				OPTIONAL MATCH (w)-[:DELIVERED]->(earlier:WebhookDelivery {EventId: $eventId})
+				WITH w, count(earlier) AS earlier
+				CREATE (w)-[:DELIVERED]->(d:WebhookDelivery)
+				SET d.Id = randomUUID(), d.WebhookId = $webhookId, d.EventId = $eventId, d.EventType = $eventType,
+					d.Attempt = earlier + 1, d.StatusCode = $statusCode, d.Error = $error, d.Success = $success,
+					d.AttemptAt = $attemptAt
+				RETURN d.Attempt`,
+				map[string]interface{}{"webhookId": delivery.WebhookId, "eventId": delivery.EventId,
+					"eventType": delivery.EventType, "statusCode": delivery.StatusCode,
+					"error": delivery.Error, "success": delivery.Success, "attemptAt": delivery.AttemptAt})
+			if err != nil {
+				return nil, err
+			}
+			if !result.Next(ctx) {
+				// The webhook was deleted meanwhile
+				return int64(0), result.Err()
+			}
+			return recordInt64(result.Record(), 0)
+		})
+	if err != nil {
+		fr.logger.Println("Error inserting webhook delivery:", err)
+		return err
+	}
+	delivery.Attempt = int(attempt.(int64))
+	return nil
+}
+
+// PruneWebhookDeliveries deletes the delivery log entries of attempts made
+// before the given time.
+func (fr *FollowRepo) PruneWebhookDeliveries(ctx context.Context, before time.Time) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	_, err := fr.executeWrite(ctx, session, "PruneWebhookDeliveries",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := transaction.Run(ctx,
+				`MATCH (d:WebhookDelivery)
+				WHERE d.AttemptAt < $before
+				DETACH DELETE d`,
+				map[string]interface{}{"before": before})
+			return nil, err
+		})
+	if err != nil {
+		fr.logger.Println("Error pruning webhook deliveries:", err)
+		return err
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first.
+func (fr *FollowRepo) GetWebhookDeliveries(ctx context.Context, webhookId string, options ListOptions) ([]model.WebhookDelivery, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	params := options.params(0)
+	params["webhookId"] = webhookId
+
+	deliveries, err := fr.executeRead(ctx, session, "GetWebhookDeliveries",
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (w:Webhook {Id: $webhookId})
+				OPTIONAL MATCH (w)-[:DELIVERED]->(d:WebhookDelivery)
+				RETURN d
+				ORDER BY d.AttemptAt DESC SKIP $skip LIMIT $limit`,
+				params)
+			if err != nil {
+				return nil, err
+			}
+
+			found := false
+			deliveryList := []model.WebhookDelivery{}
+			for result.Next(ctx) {
+				found = true
+				node, ok := result.Record().Values[0].(neo4j.Node)
+				if !ok {
+					continue
+				}
+				deliveryList = append(deliveryList, webhookDeliveryFromNode(node))
+			}
+			if err := result.Err(); err != nil {
+				return nil, err
+			}
+			if !found && options.Skip == 0 {
+				return nil, ErrWebhookNotFound
+			}
+			return deliveryList, nil
+		})
+	if err != nil {
+		if !errors.Is(err, ErrWebhookNotFound) {
+			fr.logger.Println("Error getting webhook deliveries:", err)
+		}
+		return nil, err
+	}
+	return deliveries.([]model.WebhookDelivery), nil
+}
+
+func (fr *FollowRepo) queryWebhooks(ctx context.Context, method string, query string, params map[string]interface{}) ([]model.Webhook, error) {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	webhooks, err := fr.executeRead(ctx, session, method,
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx, query, params)
+			if err != nil {
+				return nil, err
+			}
+
+			webhookList := []model.Webhook{}
+			for result.Next(ctx) {
+				node, err := recordNode(result.Record(), 0)
+				if err != nil {
+					return nil, err
+				}
+				webhookList = append(webhookList, webhookFromNode(node))
+			}
+			return webhookList, result.Err()
+		})
+	if err != nil {
+		fr.logger.Println("Error getting webhooks:", err)
+		return nil, err
+	}
+	return webhooks.([]model.Webhook), nil
+}
+
+func (fr *FollowRepo) updateWebhook(ctx context.Context, method string, webhookId string, query string, params map[string]interface{}) error {
+	session := fr.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+	defer session.Close(ctx)
+
+	params["id"] = webhookId
+	updated, err := fr.executeWrite(ctx, session, method,
+		func(transaction neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := transaction.Run(ctx, query, params)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return recordInt64(record, 0)
+		})
+	if err != nil {
+		fr.logger.Println("Error updating webhook:", err)
+		return err
+	}
+	if updated, _ := updated.(int64); updated == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func webhookFromNode(node neo4j.Node) model.Webhook {
+	webhook := model.Webhook{}
+	webhook.Id, _ = node.Props["Id"].(string)
+	webhook.Url, _ = node.Props["Url"].(string)
+	if eventTypes, ok := node.Props["EventTypes"].([]interface{}); ok {
+		for _, eventType := range eventTypes {
+			if value, ok := eventType.(string); ok {
+				webhook.EventTypes = append(webhook.EventTypes, value)
+			}
+		}
+	}
+	webhook.Secret, _ = node.Props["Secret"].(string)
+	webhook.Active, _ = node.Props["Active"].(bool)
+	if failures, ok := node.Props["ConsecutiveFailures"].(int64); ok {
+		webhook.ConsecutiveFailures = int(failures)
+	}
+	webhook.CreatedAt, _ = node.Props["CreatedAt"].(time.Time)
+	return webhook
+}
+
+func webhookDeliveryFromNode(node neo4j.Node) model.WebhookDelivery {
+	delivery := model.WebhookDelivery{}
+	delivery.Id, _ = node.Props["Id"].(string)
+	delivery.WebhookId, _ = node.Props["WebhookId"].(string)
+	delivery.EventId, _ = node.Props["EventId"].(string)
+	delivery.EventType, _ = node.Props["EventType"].(string)
+	if attempt, ok := node.Props["Attempt"].(int64); ok {
+		delivery.Attempt = int(attempt)
+	}
+	if statusCode, ok := node.Props["StatusCode"].(int64); ok {
+		delivery.StatusCode = int(statusCode)
+	}
+	delivery.Error, _ = node.Props["Error"].(string)
+	delivery.Success, _ = node.Props["Success"].(bool)
+	delivery.AttemptAt, _ = node.Props["AttemptAt"].(time.Time)
+	return delivery
+}
@@ -0,0 +1,118 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"followers-service.xws.com/model"
+)
+
+// Store reads the recent follow history per user and records the flags the
+// detector raises.
+type Store interface {
+	GetFollowActivity(ctx context.Context, since time.Time, minActions int) ([]model.FollowActivity, error)
+	FlagSuspiciousUser(ctx context.Context, activity model.FollowActivity, reason string, limitedUntil time.Time) error
+}
+
+// Thresholds decide which follow activity over Window counts as spam. A user
+// exceeding any of the maximums is flagged and limited for LimitFor from
+// when the flag is raised.
+type Thresholds struct {
+	Window       time.Duration
+	MaxFollows   int
+	MaxUnfollows int
+	MaxChurned   int
+	LimitFor     time.Duration
+}
+
+var DefaultThresholds = Thresholds{
+	Window:       24 * time.Hour,
+	MaxFollows:   500,
+	MaxUnfollows: 300,
+	MaxChurned:   100,
+	LimitFor:     24 * time.Hour,
+}
+
+// Detector periodically looks for users who follow and unfollow in bulk to
+// farm follow-backs, and flags them so their follows are shadow-limited.
+type Detector struct {
+	store      Store
+	logger     *log.Logger
+	interval   time.Duration
+	thresholds Thresholds
+}
+
+func NewDetector(store Store, logger *log.Logger, thresholds Thresholds) *Detector {
+	return &Detector{store: store, logger: logger, interval: 10 * time.Minute, thresholds: thresholds}
+}
+
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Scan(ctx); err != nil {
+			d.logger.Println("Error scanning for follow spam:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan flags every user whose activity over the window exceeds a threshold.
+func (d *Detector) Scan(ctx context.Context) error {
+	now := time.Now().UTC()
+	activity, err := d.store.GetFollowActivity(ctx, now.Add(-d.thresholds.Window), d.minActions())
+	if err != nil {
+		return err
+	}
+	for _, user := range activity {
+		reason := d.reason(user)
+		if reason == "" {
+			continue
+		}
+		if err := d.store.FlagSuspiciousUser(ctx, user, reason, now.Add(d.thresholds.LimitFor)); err != nil {
+			return err
+		}
+		d.logger.Printf("Flagged user %d: %s", user.UserID, reason)
+	}
+	return nil
+}
+
+// minActions is the least activity that can exceed a threshold, so quiet
+// users are not even loaded.
+func (d *Detector) minActions() int {
+	min := d.thresholds.MaxFollows
+	if d.thresholds.MaxUnfollows < min {
+		min = d.thresholds.MaxUnfollows
+	}
+	// Each churned user takes a follow and an unfollow
+	if 2*d.thresholds.MaxChurned < min {
+		min = 2 * d.thresholds.MaxChurned
+	}
+	return min + 1
+}
+
+func (d *Detector) reason(user model.FollowActivity) string {
+	var reasons []string
+	if user.Follows > d.thresholds.MaxFollows {
+		reasons = append(reasons, fmt.Sprintf("%d follows", user.Follows))
+	}
+	if user.Unfollows > d.thresholds.MaxUnfollows {
+		reasons = append(reasons, fmt.Sprintf("%d unfollows", user.Unfollows))
+	}
+	if user.Churned > d.thresholds.MaxChurned {
+		reasons = append(reasons, fmt.Sprintf("followed and unfollowed %d users", user.Churned))
+	}
+	if reasons == nil {
+		return ""
+	}
+	return strings.Join(reasons, ", ") + " in " + d.thresholds.Window.String()
+}
@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"followers-service.xws.com/events"
+)
+
+// Entry is an event as seen by stream subscribers. The event ID is what
+// clients send back as Last-Event-ID; unlike a counter it is the same on every
+// replica, since each one receives every event from the broker.
+type Entry struct {
+	UserIDs []int
+	Event   events.Event
+}
+
+// Hub is an events.Publisher that fans follow and unfollow events out to the
+// live streams of the users involved. The most recent events are kept in a
+// short in-memory log so that reconnecting clients can resume. An event whose
+// ID is still in the log is ignored, so a redelivered event does not reach the
+// streams twice.
+type Hub struct {
+	mu          sync.Mutex
+	history     []Entry
+	logged      map[string]struct{}
+	capacity    int
+	subscribers map[int]map[chan Entry]struct{}
+}
+
+func NewHub(capacity int) *Hub {
+	return &Hub{
+		capacity:    capacity,
+		logged:      map[string]struct{}{},
+		subscribers: map[int]map[chan Entry]struct{}{},
+	}
+}
+
+func (h *Hub) Publish(ctx context.Context, event events.Event) error {
+	if event.Type != events.Followed && event.Type != events.Unfollowed {
+		return nil
+	}
+	data := events.FollowData{}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.logged[event.Id]; ok {
+		return nil
+	}
+	entry := Entry{UserIDs: []int{data.FollowedID, data.FollowerID}, Event: event}
+	h.history = append(h.history, entry)
+	h.logged[event.Id] = struct{}{}
+	if len(h.history) > h.capacity {
+		for _, dropped := range h.history[:len(h.history)-h.capacity] {
+			delete(h.logged, dropped.Event.Id)
+		}
+		h.history = h.history[len(h.history)-h.capacity:]
+	}
+
+	for _, userID := range entry.UserIDs {
+		for ch := range h.subscribers[userID] {
+			select {
+			case ch <- entry:
+			default:
+				// The client is not keeping up; drop it so that it reconnects
+				// and resumes from its Last-Event-ID.
+				h.removeLocked(userID, ch)
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a stream for userID. It returns the logged events after
+// the one with lastEventID that concern the user, followed by a channel of
+// new ones. When lastEventID is empty or no longer in the log, the client may
+// have missed any of the logged events, so all of them are returned; clients
+// drop the ones they have seen by their ID. The channel is closed when cancel
+// is called or the subscriber falls behind.
+func (h *Hub) Subscribe(userID int, lastEventID string) ([]Entry, <-chan Entry, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := 0
+	if _, ok := h.logged[lastEventID]; ok {
+		for i, entry := range h.history {
+			if entry.Event.Id == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	var missed []Entry
+	for _, entry := range h.history[start:] {
+		if concerns(entry, userID) {
+			missed = append(missed, entry)
+		}
+	}
+
+	ch := make(chan Entry, 16)
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[chan Entry]struct{}{}
+	}
+	h.subscribers[userID][ch] = struct{}{}
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.removeLocked(userID, ch)
+	}
+	return missed, ch, cancel
+}
+
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, channels := range h.subscribers {
+		for ch := range channels {
+			h.removeLocked(userID, ch)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) removeLocked(userID int, ch chan Entry) {
+	if _, ok := h.subscribers[userID][ch]; !ok {
+		return
+	}
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+	close(ch)
+}
+
+func concerns(entry Entry, userID int) bool {
+	for _, id := range entry.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
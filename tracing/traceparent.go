@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	traceparentFlags  = 0x01
+)
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// traceparentPropagator reads and writes W3C Trace Context traceparent
+// headers, "00-<32 hex trace ID>-<16 hex span ID>-<2 hex flags>". Requests
+// from callers still sending Jaeger's own uber-trace-id header are accepted
+// through fallback.
+type traceparentPropagator struct {
+	fallback jaeger.Extractor
+}
+
+func newTraceparentPropagator() *traceparentPropagator {
+	headers := (&jaeger.HeadersConfig{}).ApplyDefaults()
+	return &traceparentPropagator{fallback: jaeger.NewHTTPHeaderPropagator(headers, *jaeger.NewNullMetrics())}
+}
+
+func (p *traceparentPropagator) Inject(context jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	flags := 0
+	if context.IsSampled() {
+		flags |= traceparentFlags
+	}
+	traceID := context.TraceID()
+	writer.Set(traceparentHeader, fmt.Sprintf("00-%016x%016x-%016x-%02x", traceID.High, traceID.Low, uint64(context.SpanID()), flags))
+	return nil
+}
+
+func (p *traceparentPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var traceparent string
+	err := reader.ForeachKey(func(key, value string) error {
+		if strings.EqualFold(key, traceparentHeader) {
+			traceparent = value
+		}
+		return nil
+	})
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	if traceparent == "" {
+		return p.fallback.Extract(carrier)
+	}
+	return parseTraceparent(traceparent)
+}
+
+func parseTraceparent(value string) (jaeger.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	// Later versions may append fields, version 00 has exactly four
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return jaeger.SpanContext{}, errInvalidTraceparent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return jaeger.SpanContext{}, errInvalidTraceparent
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return jaeger.SpanContext{}, errInvalidTraceparent
+		}
+	}
+	traceID, err := jaeger.TraceIDFromString(parts[1])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, errInvalidTraceparent
+	}
+	spanID, err := jaeger.SpanIDFromString(parts[2])
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, errInvalidTraceparent
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, errInvalidTraceparent
+	}
+	return jaeger.NewSpanContext(traceID, spanID, 0, flags&traceparentFlags != 0, nil), nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// setter adapts a header's Set method to opentracing.TextMapWriter.
+type setter func(key, value string)
+
+func (s setter) Set(key, value string) {
+	s(key, value)
+}
+
+// Inject hands the trace of the span in ctx on through set, e.g. the Set
+// method of an outgoing request's or message's headers. It does nothing when
+// ctx has no span.
+func Inject(ctx context.Context, set func(key, value string)) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	span.Tracer().Inject(span.Context(), opentracing.TextMap, setter(set))
+}
+
+// Traceparent returns the traceparent of the span in ctx, for keeping the
+// trace with work that is picked up later. It is empty when ctx has no span.
+func Traceparent(ctx context.Context) string {
+	var traceparent string
+	Inject(ctx, func(key, value string) {
+		if key == traceparentHeader {
+			traceparent = value
+		}
+	})
+	return traceparent
+}
+
+// StartSpanFollowing starts a span that follows from the trace traceparent
+// was taken from, or one in a new trace when traceparent is empty or invalid.
+func StartSpanFollowing(ctx context.Context, operationName string, traceparent string) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	var options []opentracing.StartSpanOption
+	parent, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{traceparentHeader: traceparent})
+	if err == nil {
+		options = append(options, opentracing.FollowsFrom(parent))
+	}
+	span := tracer.StartSpan(operationName, options...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	traceIDHex = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanIDHex  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{name: "sampled", value: "00-" + traceIDHex + "-" + spanIDHex + "-01", valid: true, sampled: true},
+		{name: "not sampled", value: "00-" + traceIDHex + "-" + spanIDHex + "-00", valid: true},
+		{name: "unknown flags are ignored", value: "00-" + traceIDHex + "-" + spanIDHex + "-03", valid: true, sampled: true},
+		{name: "surrounding spaces", value: " 00-" + traceIDHex + "-" + spanIDHex + "-01 ", valid: true, sampled: true},
+		{name: "future version with extra fields", value: "01-" + traceIDHex + "-" + spanIDHex + "-01-what-the-future-holds", valid: true, sampled: true},
+		{name: "version 00 with extra fields", value: "00-" + traceIDHex + "-" + spanIDHex + "-01-extra"},
+		{name: "version ff", value: "ff-" + traceIDHex + "-" + spanIDHex + "-01"},
+		{name: "version not hex", value: "zz-" + traceIDHex + "-" + spanIDHex + "-01"},
+		{name: "all-zero trace ID", value: "00-00000000000000000000000000000000-" + spanIDHex + "-01"},
+		{name: "all-zero span ID", value: "00-" + traceIDHex + "-0000000000000000-01"},
+		{name: "short trace ID", value: "00-" + traceIDHex[1:] + "-" + spanIDHex + "-01"},
+		{name: "short span ID", value: "00-" + traceIDHex + "-" + spanIDHex[1:] + "-01"},
+		{name: "upper case", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanIDHex + "-01"},
+		{name: "flags not hex", value: "00-" + traceIDHex + "-" + spanIDHex + "-0g"},
+		{name: "missing flags", value: "00-" + traceIDHex + "-" + spanIDHex},
+		{name: "empty", value: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spanContext, err := parseTraceparent(test.value)
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("accepted %q", test.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rejected %q: %v", test.value, err)
+			}
+			if got := spanContext.TraceID().String(); got != traceIDHex {
+				t.Errorf("trace ID %s, want %s", got, traceIDHex)
+			}
+			if got := spanContext.SpanID().String(); got != spanIDHex {
+				t.Errorf("span ID %s, want %s", got, spanIDHex)
+			}
+			if spanContext.IsSampled() != test.sampled {
+				t.Errorf("sampled = %v, want %v", spanContext.IsSampled(), test.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentPropagator(t *testing.T) {
+	propagator := newTraceparentPropagator()
+	traceID, _ := jaeger.TraceIDFromString(traceIDHex)
+	spanID, _ := jaeger.SpanIDFromString(spanIDHex)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string // traceparent of the extracted context, empty for none
+	}{
+		{
+			name:    "traceparent",
+			headers: map[string]string{"traceparent": "00-" + traceIDHex + "-" + spanIDHex + "-01"},
+			want:    "00-" + traceIDHex + "-" + spanIDHex + "-01",
+		},
+		{
+			name:    "header names are case-insensitive",
+			headers: map[string]string{"Traceparent": "00-" + traceIDHex + "-" + spanIDHex + "-00"},
+			want:    "00-" + traceIDHex + "-" + spanIDHex + "-00",
+		},
+		{
+			name:    "uber-trace-id fallback",
+			headers: map[string]string{"uber-trace-id": traceIDHex + ":" + spanIDHex + ":0:1"},
+			want:    "00-" + traceIDHex + "-" + spanIDHex + "-01",
+		},
+		{
+			name: "traceparent wins over uber-trace-id",
+			headers: map[string]string{
+				"traceparent":   "00-" + traceIDHex + "-" + spanIDHex + "-00",
+				"uber-trace-id": traceIDHex + ":00000000000000aa:0:1",
+			},
+			want: "00-" + traceIDHex + "-" + spanIDHex + "-00",
+		},
+		{
+			name:    "invalid traceparent",
+			headers: map[string]string{"traceparent": "ff-" + traceIDHex + "-" + spanIDHex + "-01"},
+		},
+		{
+			name:    "no headers",
+			headers: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spanContext, err := propagator.Extract(opentracing.TextMapCarrier(test.headers))
+			if test.want == "" {
+				if err == nil {
+					t.Fatalf("extracted %v", spanContext)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+			carrier := opentracing.TextMapCarrier{}
+			if err := propagator.Inject(spanContext, carrier); err != nil {
+				t.Fatalf("inject: %v", err)
+			}
+			if got := carrier["traceparent"]; got != test.want {
+				t.Errorf("traceparent %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	t.Run("inject round trip", func(t *testing.T) {
+		for _, sampled := range []bool{true, false} {
+			carrier := opentracing.TextMapCarrier{}
+			want := jaeger.NewSpanContext(traceID, spanID, 0, sampled, nil)
+			if err := propagator.Inject(want, carrier); err != nil {
+				t.Fatalf("inject: %v", err)
+			}
+			got, err := propagator.Extract(carrier)
+			if err != nil {
+				t.Fatalf("extract %q: %v", carrier["traceparent"], err)
+			}
+			if got.TraceID() != traceID || got.SpanID() != spanID || got.IsSampled() != sampled {
+				t.Errorf("round trip of %v gave %v", want, got)
+			}
+		}
+	})
+
+	t.Run("invalid carrier", func(t *testing.T) {
+		if err := propagator.Inject(jaeger.NewSpanContext(traceID, spanID, 0, true, nil), "carrier"); err != opentracing.ErrInvalidCarrier {
+			t.Errorf("inject error %v, want %v", err, opentracing.ErrInvalidCarrier)
+		}
+	})
+}
+
+// TestInjectContinuesTrace checks that a span started from Traceparent of
+// another span belongs to the same trace, as the outbox relay relies on.
+func TestInjectContinuesTrace(t *testing.T) {
+	propagator := newTraceparentPropagator()
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter(),
+		jaeger.TracerOptions.Injector(opentracing.TextMap, propagator),
+		jaeger.TracerOptions.Extractor(opentracing.TextMap, propagator))
+	defer closer.Close()
+	previous := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(previous)
+
+	if got := Traceparent(context.Background()); got != "" {
+		t.Fatalf("traceparent without a span: %q", got)
+	}
+
+	parent := tracer.StartSpan("parent")
+	defer parent.Finish()
+	headers := map[string]string{}
+	Inject(opentracing.ContextWithSpan(context.Background(), parent), func(key, value string) {
+		headers[key] = value
+	})
+	traceparent := headers["traceparent"]
+	if traceparent == "" {
+		t.Fatalf("no traceparent injected, headers %v", headers)
+	}
+
+	child, _ := StartSpanFollowing(context.Background(), "child", traceparent)
+	defer child.Finish()
+	parentContext := parent.Context().(jaeger.SpanContext)
+	childContext := child.Context().(jaeger.SpanContext)
+	if childContext.TraceID() != parentContext.TraceID() {
+		t.Errorf("child trace %v, want %v", childContext.TraceID(), parentContext.TraceID())
+	}
+	if childContext.ParentID() != parentContext.SpanID() {
+		t.Errorf("child parent %v, want %v", childContext.ParentID(), parentContext.SpanID())
+	}
+
+	orphan, _ := StartSpanFollowing(context.Background(), "orphan", "")
+	defer orphan.Finish()
+	if orphan.Context().(jaeger.SpanContext).TraceID() == parentContext.TraceID() {
+		t.Error("span without traceparent joined the parent trace")
+	}
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// Init creates the tracer from the standard JAEGER_* variables and makes it
+// the global one. Spans go to the agent at JAEGER_AGENT_HOST, or to the
+// collector at JAEGER_ENDPOINT, and every trace is sampled unless
+// JAEGER_SAMPLER_TYPE says otherwise. TRACING_EXPORTER=stdout logs finished
+// spans instead, and JAEGER_DISABLED=true turns tracing off.
+func Init(serviceName string, logger *log.Logger) (opentracing.Tracer, io.Closer, error) {
+	config, err := jaegercfg.FromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = serviceName
+	}
+	if config.Sampler.Type == "" {
+		config.Sampler.Type = jaeger.SamplerTypeConst
+		config.Sampler.Param = 1
+	}
+
+	propagator := newTraceparentPropagator()
+	options := []jaegercfg.Option{
+		jaegercfg.Logger(loggerAdapter{logger}),
+		jaegercfg.Gen128Bit(true),
+		jaegercfg.Injector(opentracing.HTTPHeaders, propagator),
+		jaegercfg.Extractor(opentracing.HTTPHeaders, propagator),
+		jaegercfg.Injector(opentracing.TextMap, propagator),
+		jaegercfg.Extractor(opentracing.TextMap, propagator),
+	}
+	switch exporter := os.Getenv("TRACING_EXPORTER"); exporter {
+	case "", "jaeger":
+	case "stdout":
+		options = append(options, jaegercfg.Reporter(jaeger.NewLoggingReporter(loggerAdapter{logger})))
+	default:
+		return nil, nil, fmt.Errorf("TRACING_EXPORTER: unknown exporter %q", exporter)
+	}
+
+	tracer, closer, err := config.NewTracer(options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	opentracing.SetGlobalTracer(tracer)
+	return tracer, closer, nil
+}
+
+// loggerAdapter lets jaeger log through the service's loggers.
+type loggerAdapter struct {
+	logger *log.Logger
+}
+
+func (l loggerAdapter) Error(msg string) {
+	l.logger.Println("Error:", msg)
+}
+
+func (l loggerAdapter) Infof(msg string, args ...interface{}) {
+	l.logger.Printf(msg, args...)
+}
@@ -0,0 +1,219 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"followers-service.xws.com/events"
+	"followers-service.xws.com/model"
+	"followers-service.xws.com/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	SignatureHeader = "X-Followers-Signature"
+	EventHeader     = "X-Followers-Event"
+	DeliveryHeader  = "X-Followers-Delivery"
+)
+
+// Store looks up the webhooks an event goes to and keeps their delivery log
+// and failure counts.
+type Store interface {
+	GetActiveWebhooksForEvent(ctx context.Context, eventType string) ([]model.Webhook, error)
+	AddWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	RecordWebhookResult(ctx context.Context, webhookId string, success bool, disableAfter int) error
+	PruneWebhookDeliveries(ctx context.Context, before time.Time) error
+}
+
+// Dispatcher is an events.PartialPublisher that POSTs every event to the
+// webhooks subscribed to its type, a few at a time, and reports which of them
+// took it. Retries are left to the outbox relay, which only goes back to the
+// webhooks that failed. Each attempt is written to the delivery log, which is
+// kept for retainedFor.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	logger *log.Logger
+
+	concurrency  int
+	disableAfter int
+	retainedFor  time.Duration
+}
+
+func NewDispatcher(store Store, logger *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:        store,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		logger:       logger,
+		concurrency:  8,
+		disableAfter: 20,
+		retainedFor:  7 * 24 * time.Hour,
+	}
+}
+
+// Sign returns the value of the signature header for payload, the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event events.Event) error {
+	_, err := d.PublishExcept(ctx, event, nil)
+	return err
+}
+
+// PublishExcept posts the event to the subscribed webhooks whose IDs are not
+// in done and returns done together with the IDs of the webhooks that took
+// it now. It fails if any webhook did not.
+func (d *Dispatcher) PublishExcept(ctx context.Context, event events.Event, done []string) ([]string, error) {
+	webhooks, err := d.store.GetActiveWebhooksForEvent(ctx, event.Type)
+	if err != nil {
+		return done, err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return done, err
+	}
+
+	reached := append([]string(nil), done...)
+	failed := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, d.concurrency)
+	for _, webhook := range webhooks {
+		if contains(done, webhook.Id) {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(webhook model.Webhook) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			success := d.deliver(ctx, webhook, event, payload)
+			mu.Lock()
+			defer mu.Unlock()
+			if success {
+				reached = append(reached, webhook.Id)
+			} else {
+				failed++
+			}
+		}(webhook)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return reached, fmt.Errorf("%d of %d webhooks failed", failed, len(webhooks))
+	}
+	return reached, nil
+}
+
+// Run prunes the delivery log every hour until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := d.store.PruneWebhookDeliveries(ctx, time.Now().Add(-d.retainedFor)); err != nil {
+			d.logger.Println("Error pruning webhook deliveries:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) Close() error {
+	return nil
+}
+
+// deliver makes one attempt at posting the event to webhook and logs it. A
+// webhook is disabled once disableAfter attempts in a row have failed.
+func (d *Dispatcher) deliver(ctx context.Context, webhook model.Webhook, event events.Event, payload []byte) bool {
+	delivery := d.attempt(ctx, webhook, event, payload)
+	// The delivery log is written even when the relay is shutting down
+	if err := d.store.AddWebhookDelivery(context.Background(), delivery); err != nil {
+		d.logger.Println("Error logging webhook delivery:", err)
+	}
+	if err := d.store.RecordWebhookResult(context.Background(), webhook.Id, delivery.Success, d.disableAfter); err != nil {
+		d.logger.Println("Error recording webhook result:", err)
+	}
+	if !delivery.Success {
+		d.logger.Printf("Error delivering event %s to webhook %s: %s", event.Id, webhook.Id, delivery.Error)
+	}
+	return delivery.Success
+}
+
+// attempt posts the event once, in a span of the trace in ctx that is passed
+// on to the receiver.
+func (d *Dispatcher) attempt(ctx context.Context, webhook model.Webhook, event events.Event, payload []byte) *model.WebhookDelivery {
+	delivery := &model.WebhookDelivery{
+		WebhookId: webhook.Id,
+		EventId:   event.Id,
+		EventType: event.Type,
+		AttemptAt: time.Now().UTC(),
+	}
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "webhook "+event.Type)
+	ext.SpanKindRPCClient.Set(span)
+	span.SetTag("webhook.id", webhook.Id)
+	span.SetTag("event.id", event.Id)
+	defer func() {
+		if !delivery.Success {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.String("error", delivery.Error))
+		}
+		span.Finish()
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, event.Type)
+	request.Header.Set(DeliveryHeader, event.Id)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, payload))
+	tracing.Inject(ctx, request.Header.Set)
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer response.Body.Close()
+
+	delivery.StatusCode = response.StatusCode
+	ext.HTTPStatusCode.Set(span, uint16(response.StatusCode))
+	delivery.Success = response.StatusCode >= 200 && response.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %s", response.Status)
+	}
+	return delivery
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}